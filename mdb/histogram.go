@@ -0,0 +1,88 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"math"
+
+	"github.com/simagix/gox"
+)
+
+// latencyBounds are upper bounds, in milliseconds, of histogram buckets
+var latencyBounds = []int{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000, 20000, 50000, 100000}
+
+// Histogram keeps latency counts in log scaled buckets, the last bucket is unbounded
+type Histogram []int
+
+// NewHistogram returns an empty latency histogram
+func NewHistogram() Histogram {
+	return make(Histogram, len(latencyBounds)+1)
+}
+
+// Add adds a latency in milliseconds
+func (h Histogram) Add(milli int) {
+	if len(h) == 0 {
+		return
+	}
+	for i, bound := range latencyBounds {
+		if milli <= bound {
+			h[i]++
+			return
+		}
+	}
+	h[len(h)-1]++
+}
+
+// Merge adds counts of another histogram
+func (h Histogram) Merge(other Histogram) {
+	for i := 0; i < len(h) && i < len(other); i++ {
+		h[i] += other[i]
+	}
+}
+
+// Total returns total counts
+func (h Histogram) Total() int {
+	total := 0
+	for _, n := range h {
+		total += n
+	}
+	return total
+}
+
+// Percentile returns the upper bound of the bucket holding the given percentile, capped by max
+func (h Histogram) Percentile(p float64, max int) int {
+	total := h.Total()
+	if total == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+	cnt := 0
+	for i, n := range h {
+		cnt += n
+		if cnt >= rank {
+			if i < len(latencyBounds) && latencyBounds[i] < max {
+				return latencyBounds[i]
+			}
+			return max
+		}
+	}
+	return max
+}
+
+// setPercentiles sets p50, p95 and p99 from the histogram
+func (doc *OpPerformanceDoc) setPercentiles() {
+	doc.P50 = doc.Histogram.Percentile(50, doc.MaxMilli)
+	doc.P95 = doc.Histogram.Percentile(95, doc.MaxMilli)
+	doc.P99 = doc.Histogram.Percentile(99, doc.MaxMilli)
+}
+
+// percentileString returns a percentile as a time string, reports saved without histograms show -
+func percentileString(doc OpPerformanceDoc, milli int) string {
+	if len(doc.Histogram) == 0 {
+		return "-"
+	}
+	return gox.MilliToTimeString(float64(milli))
+}
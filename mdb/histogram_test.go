@@ -0,0 +1,41 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"testing"
+)
+
+func TestHistogramPercentile(t *testing.T) {
+	h := NewHistogram()
+	for i := 0; i < 98; i++ {
+		h.Add(150)
+	}
+	h.Add(1500)
+	h.Add(30000)
+	if p := h.Percentile(50, 30000); p != 200 {
+		t.Fatal("expected p50 200, but got", p)
+	}
+	if p := h.Percentile(99, 30000); p != 2000 {
+		t.Fatal("expected p99 2000, but got", p)
+	}
+	if p := h.Percentile(100, 30000); p != 30000 {
+		t.Fatal("expected p100 30000, but got", p)
+	}
+	var old Histogram // reports saved without histograms
+	if p := old.Percentile(95, 100); p != 0 {
+		t.Fatal("expected 0, but got", p)
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	h := NewHistogram()
+	h.Add(10)
+	other := NewHistogram()
+	other.Add(10)
+	other.Add(200000)
+	h.Merge(other)
+	if h.Total() != 3 || h[len(h)-1] != 1 {
+		t.Fatal("unexpected merged histogram", h)
+	}
+}
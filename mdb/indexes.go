@@ -20,17 +20,27 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
 )
 
 // Indexes holder indexes reader struct
 type Indexes struct {
-	client     *mongo.Client
-	dbName     string
-	filename   string
-	indexesMap map[string]CollectionIndexes
-	nocolor    bool
-	verbose    bool
+	auto            bool
+	client          *mongo.Client
+	commitQuorum    string
+	connString      connstring.ConnString
+	dbName          string
+	dryRun          bool
+	filename        string
+	files           []string // TLS CA file and client certificate key file
+	indexesMap      map[string]CollectionIndexes
+	maxBuilds       int
+	maxCollBuilds   int
+	nocolor         bool
+	retireStateFile string
+	scriptFile      string
+	verbose         bool
+	watchPeriod     time.Duration
 }
 
 // AccessesDoc - accessss
@@ -72,7 +82,8 @@ type IndexStatsDoc struct {
 func NewIndexes(client *mongo.Client) *Indexes {
 	gob.Register([]IndexStatsDoc{})
 	hostname, _ := os.Hostname()
-	return &Indexes{client: client, filename: hostname + "-index.bson.gz", indexesMap: map[string]CollectionIndexes{}}
+	return &Indexes{client: client, filename: hostname + "-index.bson.gz", indexesMap: map[string]CollectionIndexes{},
+		maxBuilds: 1, maxCollBuilds: 1, retireStateFile: "keyhole-retire.json", watchPeriod: 7 * 24 * time.Hour}
 }
 
 // SetFilename sets output file name
@@ -143,7 +154,9 @@ func (ix *Indexes) GetIndexes() (map[string]CollectionIndexes, error) {
 	var dbNames []string
 	ix.indexesMap = map[string]CollectionIndexes{} // reset
 	if ix.dbName != "" {
-		ix.indexesMap[ix.dbName], err = ix.GetIndexesFromDB(ix.dbName)
+		if ix.indexesMap[ix.dbName], err = ix.GetIndexesFromDB(ix.dbName); err == nil && ix.connString.String() != "" {
+			ix.mergeMembersUsage()
+		}
 		return ix.indexesMap, err
 	}
 
@@ -169,6 +182,9 @@ func (ix *Indexes) GetIndexes() (map[string]CollectionIndexes, error) {
 	if cnt == 0 && ix.verbose == true {
 		log.Println("No database is available")
 	}
+	if ix.connString.String() != "" {
+		ix.mergeMembersUsage()
+	}
 	return ix.indexesMap, err
 }
 
@@ -410,64 +426,17 @@ func (ix *Indexes) PrintIndexesOf(indexesMap map[string]CollectionIndexes) {
 			fmt.Println(buffer.String())
 		}
 	}
+	for _, str := range getIndexUsageWarnings(indexesMap, time.Now()) {
+		fmt.Println("warning:", str)
+	}
 }
 
-// CreateIndexes creates indexes
+// CreateIndexes creates indexes missing from the target, or lists indexes to create of a dry run
 func (ix *Indexes) CreateIndexes() error {
-	var ctx = context.Background()
-	var err error
-	for db := range ix.indexesMap {
-		indexes := ix.indexesMap[db]
-		for k, list := range indexes {
-			collection := ix.client.Database(db).Collection(k)
-			for _, o := range list {
-				if o.IsShardKey == true {
-					// TODO
-				}
-				var indexKey bson.D
-				for _, field := range o.Fields {
-					for _, e := range o.IndexKey {
-						if field == e.Key {
-							indexKey = append(indexKey, e)
-							break
-						}
-					}
-				}
-
-				opt := options.Index()
-				opt.SetVersion(o.Version)
-				opt.SetName(o.Name)
-				if o.Background == true {
-					opt.SetBackground(o.Background)
-				}
-				if o.ExpireAfterSeconds > 0 {
-					opt.SetExpireAfterSeconds(o.ExpireAfterSeconds)
-				}
-				if o.Unique == true {
-					opt.SetUnique(o.Unique)
-				}
-				if o.Sparse == true {
-					opt.SetSparse(o.Sparse)
-				}
-				if o.Collation != nil {
-					var collation *options.Collation
-					if data, err := bson.Marshal(o.Collation); err != nil {
-						fmt.Println(err)
-					} else {
-						bson.Unmarshal(data, &collation)
-						opt.SetCollation(collation)
-					}
-				}
-				if o.PartialFilterExpression != nil {
-					opt.SetPartialFilterExpression(o.PartialFilterExpression)
-				}
-				if _, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: o.IndexKey, Options: opt}); err != nil {
-					fmt.Println(err)
-				}
-			}
-		}
+	if ix.dryRun {
+		return ix.dryRunCreateIndexes()
 	}
-	return err
+	return ix.buildIndexes()
 }
 
 // Save saves indexes map to a file
@@ -0,0 +1,264 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// status of index builds, in addition to skip and conflict of the plan
+const (
+	indexCreated = "created"
+	indexFailed  = "failed"
+)
+
+// indexBuildProgressInterval is the interval of printing progress of index builds from $currentOp
+const indexBuildProgressInterval = 10 * time.Second
+
+// IndexBuildDoc stores the result of building an index
+type IndexBuildDoc struct {
+	Duration  time.Duration // build time
+	Error     string        // error of a failed build, or differences of a conflict
+	Index     IndexStatsDoc // index of the file
+	Namespace string        // database.collection
+	Size      int64         // collection size in bytes
+	Status    string        // created, failed, skip if exists with the same spec, or conflict
+}
+
+// SetCommitQuorum sets commitQuorum of index builds, majority, votingMembers, or a number of members
+func (ix *Indexes) SetCommitQuorum(commitQuorum string) {
+	ix.commitQuorum = commitQuorum
+}
+
+// SetMaxBuilds sets max concurrent index builds of the cluster
+func (ix *Indexes) SetMaxBuilds(maxBuilds int) {
+	if maxBuilds > 0 {
+		ix.maxBuilds = maxBuilds
+	}
+}
+
+// SetMaxCollBuilds sets max concurrent index builds of a collection
+func (ix *Indexes) SetMaxCollBuilds(maxCollBuilds int) {
+	if maxCollBuilds > 0 {
+		ix.maxCollBuilds = maxCollBuilds
+	}
+}
+
+// buildIndexes builds indexes of the file missing from the target, smaller collections first, up to
+// maxBuilds concurrently and maxCollBuilds of a collection, and prints a summary
+func (ix *Indexes) buildIndexes() error {
+	plan, err := ix.GetCreateIndexesPlan()
+	if err != nil {
+		return err
+	}
+	sizes := map[string]int64{}
+	for _, doc := range plan {
+		if _, ok := sizes[doc.Namespace]; !ok && doc.Action == indexCreate {
+			sizes[doc.Namespace] = ix.getCollectionSize(doc.Namespace)
+		}
+	}
+	builds := getIndexBuilds(plan, sizes)
+	begin := time.Now()
+	ix.runIndexBuilds(builds)
+	fmt.Println(PrintIndexBuilds(builds, time.Since(begin)))
+	failed := 0
+	for _, b := range builds {
+		if b.Status == indexFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d index builds failed", failed)
+	}
+	return nil
+}
+
+// getIndexBuilds returns index builds of a plan ordered by collection size, smaller first, indexes
+// already existing or conflicting are not built
+func getIndexBuilds(plan []IndexPlanDoc, sizes map[string]int64) []IndexBuildDoc {
+	builds := make([]IndexBuildDoc, 0, len(plan))
+	for _, doc := range plan {
+		b := IndexBuildDoc{Index: doc.Index, Namespace: doc.Namespace, Size: sizes[doc.Namespace]}
+		if doc.Action != indexCreate {
+			b.Status = doc.Action
+			b.Error = strings.Join(doc.Diffs, ", ")
+		}
+		builds = append(builds, b)
+	}
+	sort.SliceStable(builds, func(i, j int) bool { return builds[i].Size < builds[j].Size })
+	return builds
+}
+
+// getCollectionSize returns size of a collection from collStats, or 0 if not exists
+func (ix *Indexes) getCollectionSize(ns string) int64 {
+	i := strings.Index(ns, ".")
+	var stats bson.M
+	cmd := bson.D{{Key: "collStats", Value: ns[i+1:]}}
+	if err := ix.client.Database(ns[:i]).RunCommand(context.Background(), cmd).Decode(&stats); err != nil {
+		return 0
+	}
+	return toInt64(stats["size"])
+}
+
+// runIndexBuilds builds indexes in order, up to maxBuilds of the cluster, a build of a collection
+// running maxCollBuilds waits without holding a slot of the cluster so that builds of other
+// collections can run
+func (ix *Indexes) runIndexBuilds(builds []IndexBuildDoc) {
+	pending := []int{}
+	for i := range builds {
+		if builds[i].Status == "" {
+			pending = append(pending, i)
+		}
+	}
+	running := map[string]int{}
+	done := make(chan int)
+	stop := make(chan struct{})
+	go ix.printIndexBuildsProgress(stop)
+	active := 0
+	for len(pending) > 0 || active > 0 {
+		for active < ix.maxBuilds {
+			n := getNextIndexBuild(builds, pending, running, ix.maxCollBuilds)
+			if n < 0 {
+				break
+			}
+			i := pending[n]
+			pending = append(pending[:n], pending[n+1:]...)
+			running[builds[i].Namespace]++
+			active++
+			go func(i int) {
+				ix.buildIndex(&builds[i])
+				done <- i
+			}(i)
+		}
+		i := <-done
+		running[builds[i].Namespace]--
+		active--
+	}
+	close(stop)
+}
+
+// getNextIndexBuild returns position in pending of the first build whose collection runs fewer than
+// maxCollBuilds, or -1 if none
+func getNextIndexBuild(builds []IndexBuildDoc, pending []int, running map[string]int, maxCollBuilds int) int {
+	for n, i := range pending {
+		if running[builds[i].Namespace] < maxCollBuilds {
+			return n
+		}
+	}
+	return -1
+}
+
+// buildIndex builds an index with createIndexes of commitQuorum
+func (ix *Indexes) buildIndex(b *IndexBuildDoc) {
+	i := strings.Index(b.Namespace, ".")
+	spec := getIndexSpec(b.Index)
+	if b.Index.Version > 0 {
+		spec = append(spec, bson.E{Key: "v", Value: b.Index.Version})
+	}
+	cmd := bson.D{{Key: "createIndexes", Value: b.Namespace[i+1:]}, {Key: "indexes", Value: bson.A{spec}}}
+	if ix.commitQuorum != "" {
+		cmd = append(cmd, bson.E{Key: "commitQuorum", Value: getCommitQuorum(ix.commitQuorum)})
+	}
+	if ix.verbose {
+		log.Println("createIndexes", b.Namespace, b.Index.Name)
+	}
+	begin := time.Now()
+	err := ix.client.Database(b.Namespace[:i]).RunCommand(context.Background(), cmd).Err()
+	b.Duration = time.Since(begin)
+	if err != nil {
+		b.Status = indexFailed
+		b.Error = err.Error()
+		return
+	}
+	b.Status = indexCreated
+}
+
+// getCommitQuorum returns commitQuorum of a number of members, or of a name, for example majority
+func getCommitQuorum(commitQuorum string) interface{} {
+	if n, err := strconv.Atoi(commitQuorum); err == nil {
+		return int32(n)
+	}
+	return commitQuorum
+}
+
+// printIndexBuildsProgress prints progress of index builds from $currentOp until stopped
+func (ix *Indexes) printIndexBuildsProgress(stop chan struct{}) {
+	ticker := time.NewTicker(indexBuildProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, str := range ix.getIndexBuildsProgress() {
+				log.Println(str)
+			}
+		}
+	}
+}
+
+// getIndexBuildsProgress returns msg and progress of createIndexes ops in $currentOp
+func (ix *Indexes) getIndexBuildsProgress() []string {
+	var err error
+	var cur *mongo.Cursor
+	var ctx = context.Background()
+	pipeline := MongoPipeline(`[{"$currentOp": {"allUsers": true}}, {"$match": {"command.createIndexes": {"$exists": true}}}]`)
+	strs := []string{}
+	if cur, err = ix.client.Database("admin").Aggregate(ctx, pipeline); err != nil {
+		if ix.verbose {
+			log.Println(err)
+		}
+		return strs
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var op bson.M
+		if err = cur.Decode(&op); err != nil {
+			continue
+		}
+		strs = append(strs, getIndexBuildProgress(op))
+	}
+	return strs
+}
+
+// getIndexBuildProgress returns namespace, msg, and progress of a createIndexes op
+func getIndexBuildProgress(op bson.M) string {
+	str := fmt.Sprintf("%v %v", op["ns"], op["msg"])
+	if progress, ok := op["progress"].(bson.M); ok && toInt64(progress["total"]) > 0 {
+		done, total := toInt64(progress["done"]), toInt64(progress["total"])
+		str += fmt.Sprintf(" (%d/%d, %d%%)", done, total, 100*done/total)
+	}
+	return str
+}
+
+// PrintIndexBuilds returns status and duration of each index build, in the order built
+func PrintIndexBuilds(builds []IndexBuildDoc, duration time.Duration) string {
+	counts := map[string]int{}
+	for _, b := range builds {
+		counts[b.Status]++
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Index builds, %d created, %d failed, %d skipped, %d conflicting, in %v\n",
+		counts[indexCreated], counts[indexFailed], counts[indexSkip], counts[indexConflict], duration.Round(time.Millisecond)))
+	for _, b := range builds {
+		str := fmt.Sprintf("  %-9s %v %v", b.Status, b.Namespace, getIndexDefinition(b.Index))
+		if b.Status == indexCreated || b.Status == indexFailed {
+			str += fmt.Sprintf(", %v", b.Duration.Round(time.Millisecond))
+		}
+		if b.Error != "" {
+			str += ", " + b.Error
+		}
+		buffer.WriteString(str + "\n")
+	}
+	return buffer.String()
+}
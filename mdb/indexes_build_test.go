@@ -0,0 +1,71 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGetIndexBuilds(t *testing.T) {
+	plan := []IndexPlanDoc{
+		{Action: indexCreate, Index: IndexStatsDoc{Name: "color_1"}, Namespace: "keyhole.cars"},
+		{Action: indexSkip, Index: IndexStatsDoc{Name: "_id_"}, Namespace: "keyhole.cars"},
+		{Action: indexCreate, Index: IndexStatsDoc{Name: "name_1"}, Namespace: "keyhole.dealers"},
+		{Action: indexConflict, Diffs: []string{"unique: false -> true"}, Index: IndexStatsDoc{Name: "vin_1"},
+			Namespace: "keyhole.cars"},
+	}
+	builds := getIndexBuilds(plan, map[string]int64{"keyhole.cars": 1 << 30, "keyhole.dealers": 1 << 20})
+	names := []string{}
+	for _, b := range builds {
+		names = append(names, b.Index.Name)
+	}
+	if strings.Join(names, ",") != "name_1,color_1,_id_,vin_1" {
+		t.Fatal("expected smaller collection first, but got", names)
+	}
+	if builds[0].Status != "" || builds[2].Status != indexSkip || builds[3].Status != indexConflict ||
+		builds[3].Error != "unique: false -> true" {
+		t.Fatal("unexpected builds", builds)
+	}
+	builds[0].Status, builds[0].Duration = indexCreated, 1500*time.Millisecond
+	builds[1].Status, builds[1].Error = indexFailed, "operation exceeded time limit"
+	str := PrintIndexBuilds(builds, 2*time.Second)
+	t.Log(str)
+	if strings.HasPrefix(str, "Index builds, 1 created, 1 failed, 1 skipped, 1 conflicting, in 2s") == false {
+		t.Fatal("unexpected summary", str)
+	}
+}
+
+func TestGetCommitQuorum(t *testing.T) {
+	if v := getCommitQuorum("2"); v != int32(2) {
+		t.Fatal("expected 2, but got", v)
+	}
+	if v := getCommitQuorum("majority"); v != "majority" {
+		t.Fatal("expected majority, but got", v)
+	}
+	op := bson.M{"ns": "keyhole.cars", "msg": "Index Build: scanning collection", "progress": bson.M{"done": int64(250), "total": int64(1000)}}
+	if str := getIndexBuildProgress(op); str != "keyhole.cars Index Build: scanning collection (250/1000, 25%)" {
+		t.Fatal("unexpected progress", str)
+	}
+}
+
+func TestGetNextIndexBuild(t *testing.T) {
+	builds := []IndexBuildDoc{
+		{Index: IndexStatsDoc{Name: "color_1"}, Namespace: "keyhole.cars"},
+		{Index: IndexStatsDoc{Name: "year_1"}, Namespace: "keyhole.cars"},
+		{Index: IndexStatsDoc{Name: "name_1"}, Namespace: "keyhole.dealers"},
+	}
+	pending := []int{1, 2}
+	if n := getNextIndexBuild(builds, pending, map[string]int{"keyhole.cars": 1}, 1); n != 1 {
+		t.Fatal("expected a build of keyhole.dealers while keyhole.cars is busy, but got", n)
+	}
+	if n := getNextIndexBuild(builds, pending, map[string]int{"keyhole.cars": 1}, 2); n != 0 {
+		t.Fatal("expected the next build of keyhole.cars, but got", n)
+	}
+	if n := getNextIndexBuild(builds, pending, map[string]int{"keyhole.cars": 1, "keyhole.dealers": 1}, 1); n != -1 {
+		t.Fatal("expected no build, but got", n)
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+// index differences of the target from the source
+const (
+	indexDifferent = "different"
+	indexExtra     = "extra"
+	indexMissing   = "missing"
+)
+
+// IndexDiff stores an index missing from, extra in, or defined differently in the target
+type IndexDiff struct {
+	Diffs     []string // differences of definitions, for example unique: false -> true
+	Namespace string
+	Source    IndexStatsDoc
+	Status    string
+	Target    IndexStatsDoc
+}
+
+// IndexesDiff compares indexes of two sources, live clusters or saved -index.bson.gz files
+type IndexesDiff struct {
+	Diffs []IndexDiff
+
+	files   []string // TLS CA file and client certificate key file
+	nocolor bool
+	verbose bool
+}
+
+// NewIndexesDiff returns IndexesDiff
+func NewIndexesDiff() *IndexesDiff {
+	return &IndexesDiff{}
+}
+
+// SetNoColor set nocolor flag
+func (d *IndexesDiff) SetNoColor(nocolor bool) {
+	d.nocolor = nocolor
+}
+
+// SetTLSFiles sets TLS CA file and client certificate key file of live sources
+func (d *IndexesDiff) SetTLSFiles(caFile string, certificateKeyFile string) {
+	d.files = []string{caFile, certificateKeyFile}
+}
+
+// SetVerbose -
+func (d *IndexesDiff) SetVerbose(verbose bool) {
+	d.verbose = verbose
+}
+
+// DiffSources compares indexes of two sources, each a MongoDB URI or a saved -index.bson.gz file
+func (d *IndexesDiff) DiffSources(source string, target string) (string, error) {
+	var err error
+	maps := []map[string]CollectionIndexes{}
+	for _, src := range []string{source, target} {
+		var indexesMap map[string]CollectionIndexes
+		if indexesMap, err = d.getIndexesMap(src); err != nil {
+			return "", err
+		}
+		maps = append(maps, indexesMap)
+	}
+	d.Compare(maps[0], maps[1])
+	return fmt.Sprintf("source: %v\ntarget: %v\n", redactURI(source), redactURI(target)) + d.Print(), nil
+}
+
+// getIndexesMap returns indexes of a cluster or a saved file
+func (d *IndexesDiff) getIndexesMap(src string) (map[string]CollectionIndexes, error) {
+	var err error
+	if strings.HasPrefix(src, "mongodb://") == false && strings.HasPrefix(src, "mongodb+srv://") == false {
+		ix := NewIndexes(nil)
+		if err = ix.SetIndexesMapFromFile(src); err != nil {
+			return nil, err
+		}
+		return ix.indexesMap, nil
+	}
+	var connString connstring.ConnString
+	if connString, err = connstring.Parse(src); err != nil {
+		return nil, err
+	}
+	client, err := NewMongoClient(src, d.files...)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Disconnect(context.Background())
+	ix := NewIndexes(client)
+	ix.SetVerbose(d.verbose)
+	if connString.Database != KeyholeDB {
+		ix.SetDBName(connString.Database)
+	}
+	return ix.GetIndexes()
+}
+
+// Compare matches indexes of each namespace by name, or by fields if renamed
+func (d *IndexesDiff) Compare(source map[string]CollectionIndexes, target map[string]CollectionIndexes) {
+	d.Diffs = []IndexDiff{}
+	sources := getIndexesByNamespace(source)
+	targets := getIndexesByNamespace(target)
+	namespaces := []string{}
+	for ns := range sources {
+		namespaces = append(namespaces, ns)
+	}
+	for ns := range targets {
+		if _, ok := sources[ns]; !ok {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		list := targets[ns]
+		matched := make([]bool, len(list))
+		for _, s := range sources[ns] {
+			i := findIndex(s, list, matched)
+			if i < 0 {
+				d.Diffs = append(d.Diffs, IndexDiff{Namespace: ns, Source: s, Status: indexMissing})
+				continue
+			}
+			matched[i] = true
+			if diffs := getIndexDefinitionDiffs(s, list[i]); len(diffs) > 0 {
+				d.Diffs = append(d.Diffs, IndexDiff{Diffs: diffs, Namespace: ns, Source: s, Status: indexDifferent,
+					Target: list[i]})
+			}
+		}
+		for i, t := range list {
+			if !matched[i] {
+				d.Diffs = append(d.Diffs, IndexDiff{Namespace: ns, Status: indexExtra, Target: t})
+			}
+		}
+	}
+}
+
+// getIndexesByNamespace returns indexes keyed by database.collection
+func getIndexesByNamespace(indexesMap map[string]CollectionIndexes) map[string][]IndexStatsDoc {
+	namespaces := map[string][]IndexStatsDoc{}
+	for db, collections := range indexesMap {
+		for coll, list := range collections {
+			namespaces[db+"."+coll] = list
+		}
+	}
+	return namespaces
+}
+
+// findIndex returns position of an unmatched index of the same name, or of the same fields in any
+// order, or -1 if not found
+func findIndex(index IndexStatsDoc, list []IndexStatsDoc, matched []bool) int {
+	for i, o := range list {
+		if !matched[i] && o.Name == index.Name {
+			return i
+		}
+	}
+	fields := getSortedFields(index.IndexKey)
+	for i, o := range list {
+		if !matched[i] && getSortedFields(o.IndexKey) == fields {
+			return i
+		}
+	}
+	return -1
+}
+
+// getSortedFields returns sorted fields of index keys
+func getSortedFields(key bson.D) string {
+	fields := make([]string, 0, len(key))
+	for _, e := range key {
+		fields = append(fields, e.Key)
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ",")
+}
+
+// getIndexDefinitionDiffs returns differences of name, keys order or direction, unique, sparse, TTL,
+// partialFilterExpression, and collation
+func getIndexDefinitionDiffs(s IndexStatsDoc, t IndexStatsDoc) []string {
+	diffs := []string{}
+	if s.Name != t.Name {
+		diffs = append(diffs, fmt.Sprintf("name: %v -> %v", s.Name, t.Name))
+	}
+	if a, b := getIndexKeyString(s.IndexKey), getIndexKeyString(t.IndexKey); a != b {
+		diffs = append(diffs, fmt.Sprintf("key: %v -> %v", a, b))
+	}
+	if s.Unique != t.Unique {
+		diffs = append(diffs, fmt.Sprintf("unique: %v -> %v", s.Unique, t.Unique))
+	}
+	if s.Sparse != t.Sparse {
+		diffs = append(diffs, fmt.Sprintf("sparse: %v -> %v", s.Sparse, t.Sparse))
+	}
+	if s.ExpireAfterSeconds != t.ExpireAfterSeconds {
+		diffs = append(diffs, fmt.Sprintf("expireAfterSeconds: %v -> %v", getTTLString(s), getTTLString(t)))
+	}
+	if a, b := getDocString(s.PartialFilterExpression), getDocString(t.PartialFilterExpression); a != b {
+		diffs = append(diffs, fmt.Sprintf("partialFilterExpression: %v -> %v", a, b))
+	}
+	if a, b := getDocString(s.Collation), getDocString(t.Collation); a != b {
+		diffs = append(diffs, fmt.Sprintf("collation: %v -> %v", a, b))
+	}
+	return diffs
+}
+
+// getTTLString returns expireAfterSeconds of an index, or none
+func getTTLString(index IndexStatsDoc) string {
+	if index.ExpireAfterSeconds == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d", index.ExpireAfterSeconds)
+}
+
+// getDocString returns a document in extended JSON, or none if empty
+func getDocString(doc bson.D) string {
+	if len(doc) == 0 {
+		return "none"
+	}
+	data, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		return fmt.Sprintf("%v", doc)
+	}
+	return string(data)
+}
+
+// getIndexDefinition returns keys and options of an index, for example { a: 1 } a_1, unique
+func getIndexDefinition(index IndexStatsDoc) string {
+	strs := []string{getIndexKeyString(index.IndexKey) + " " + index.Name}
+	if index.Unique {
+		strs = append(strs, "unique")
+	}
+	if index.Sparse {
+		strs = append(strs, "sparse")
+	}
+	if index.ExpireAfterSeconds > 0 {
+		strs = append(strs, "expireAfterSeconds: "+getTTLString(index))
+	}
+	if len(index.PartialFilterExpression) > 0 {
+		strs = append(strs, "partialFilterExpression: "+getDocString(index.PartialFilterExpression))
+	}
+	if len(index.Collation) > 0 {
+		strs = append(strs, "collation: "+getDocString(index.Collation))
+	}
+	return strings.Join(strs, ", ")
+}
+
+// redactURI removes password of a URI
+func redactURI(uri string) string {
+	if i := strings.Index(uri, "://"); i > 0 {
+		if j := strings.Index(uri, "@"); j > i {
+			if k := strings.Index(uri[i+3:j], ":"); k >= 0 {
+				return uri[:i+3+k] + ":xxxxxx" + uri[j:]
+			}
+		}
+	}
+	return uri
+}
+
+// Print returns indexes missing, extra, and defined differently in the target by namespace
+func (d *IndexesDiff) Print() string {
+	red := codeRed
+	blue := codeBlue
+	tail := codeDefault
+	if d.nocolor == true {
+		red = ""
+		blue = ""
+		tail = ""
+	}
+	counts := map[string]int{}
+	for _, diff := range d.Diffs {
+		counts[diff.Status]++
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Indexes missing %d, extra %d, different %d in target\n", counts[indexMissing],
+		counts[indexExtra], counts[indexDifferent]))
+	ns := ""
+	for _, diff := range d.Diffs {
+		if diff.Namespace != ns {
+			ns = diff.Namespace
+			buffer.WriteString("\n" + ns + ":\n")
+		}
+		switch diff.Status {
+		case indexMissing:
+			buffer.WriteString(fmt.Sprintf("  %v- %-9s %v%v\n", red, diff.Status, getIndexDefinition(diff.Source), tail))
+		case indexExtra:
+			buffer.WriteString(fmt.Sprintf("  %v+ %-9s %v%v\n", blue, diff.Status, getIndexDefinition(diff.Target), tail))
+		default:
+			buffer.WriteString(fmt.Sprintf("  ~ %-9s %v\n", diff.Status, getIndexDefinition(diff.Source)))
+			for _, str := range diff.Diffs {
+				buffer.WriteString("      " + str + "\n")
+			}
+		}
+	}
+	return buffer.String()
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// actions of indexes of a file on the target
+const (
+	indexConflict = "conflict"
+	indexCreate   = "create"
+	indexSkip     = "skip"
+)
+
+// IndexPlanDoc stores the action of an index of a file on the target
+type IndexPlanDoc struct {
+	Action    string        // create, skip if exists with the same spec, or conflict
+	Diffs     []string      // differences from the existing index of a conflict
+	Index     IndexStatsDoc // index of the file
+	Namespace string        // database.collection
+}
+
+// SetDryRun sets to list indexes to create, skip, or conflict without creating them
+func (ix *Indexes) SetDryRun(dryRun bool) {
+	ix.dryRun = dryRun
+}
+
+// SetScriptFile sets mongosh script file of createIndexes commands of a dry run
+func (ix *Indexes) SetScriptFile(filename string) {
+	ix.scriptFile = filename
+}
+
+// GetCreateIndexesPlan compares indexes of the file with indexes of the target, an index is skipped if
+// it exists with the same spec, and conflicts if the same name or keys exist with a different spec
+func (ix *Indexes) GetCreateIndexesPlan() ([]IndexPlanDoc, error) {
+	existing := map[string]CollectionIndexes{}
+	for db := range ix.indexesMap {
+		indexes, err := ix.GetIndexesFromDB(db)
+		if err != nil {
+			return nil, err
+		}
+		existing[db] = indexes
+	}
+	return getCreateIndexesPlan(ix.indexesMap, existing), nil
+}
+
+// getCreateIndexesPlan returns actions of indexes of a file on existing indexes by namespace
+func getCreateIndexesPlan(indexesMap map[string]CollectionIndexes, existing map[string]CollectionIndexes) []IndexPlanDoc {
+	plan := []IndexPlanDoc{}
+	sources := getIndexesByNamespace(indexesMap)
+	targets := getIndexesByNamespace(existing)
+	namespaces := []string{}
+	for ns := range sources {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		for _, o := range sources[ns] {
+			doc := IndexPlanDoc{Action: indexCreate, Index: o, Namespace: ns}
+			key := getIndexKeyString(o.IndexKey)
+			if key == "{ _id: 1 }" {
+				doc.Action = indexSkip // created with the collection
+			}
+			for _, t := range targets[ns] {
+				if t.Name != o.Name && getIndexKeyString(t.IndexKey) != key {
+					continue
+				}
+				if doc.Diffs = getIndexDefinitionDiffs(t, o); len(doc.Diffs) == 0 {
+					doc.Action = indexSkip
+				} else {
+					doc.Action = indexConflict
+				}
+				break
+			}
+			plan = append(plan, doc)
+		}
+	}
+	return plan
+}
+
+// PrintCreateIndexesPlan returns indexes to create, skip, and conflict by namespace
+func PrintCreateIndexesPlan(plan []IndexPlanDoc) string {
+	counts := map[string]int{}
+	for _, doc := range plan {
+		counts[doc.Action]++
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Dry run, %d to create, %d skipped, %d conflicting (existing -> file)\n",
+		counts[indexCreate], counts[indexSkip], counts[indexConflict]))
+	ns := ""
+	for _, doc := range plan {
+		if doc.Namespace != ns {
+			ns = doc.Namespace
+			buffer.WriteString("\n" + ns + ":\n")
+		}
+		note := ""
+		if doc.Index.IsShardKey {
+			note = " (shard key)"
+		}
+		buffer.WriteString(fmt.Sprintf("  %-9s %v%v\n", doc.Action, getIndexDefinition(doc.Index), note))
+		for _, str := range doc.Diffs {
+			buffer.WriteString("      " + str + "\n")
+		}
+	}
+	return buffer.String()
+}
+
+// getIndexSpec returns the spec of an index in createIndexes
+func getIndexSpec(o IndexStatsDoc) bson.D {
+	spec := bson.D{{Key: "key", Value: o.IndexKey}, {Key: "name", Value: o.Name}}
+	if o.Unique {
+		spec = append(spec, bson.E{Key: "unique", Value: true})
+	}
+	if o.Sparse {
+		spec = append(spec, bson.E{Key: "sparse", Value: true})
+	}
+	if o.ExpireAfterSeconds > 0 {
+		spec = append(spec, bson.E{Key: "expireAfterSeconds", Value: o.ExpireAfterSeconds})
+	}
+	if len(o.PartialFilterExpression) > 0 {
+		spec = append(spec, bson.E{Key: "partialFilterExpression", Value: o.PartialFilterExpression})
+	}
+	if len(o.Collation) > 0 {
+		spec = append(spec, bson.E{Key: "collation", Value: o.Collation})
+	}
+	return spec
+}
+
+// getCreateIndexesScript returns a mongosh script of a createIndexes command of each collection,
+// skipped and conflicting indexes are commented. Specs are in canonical extended JSON deserialized by
+// mongosh so that dates, ObjectIds, and longs keep their types.
+func getCreateIndexesScript(plan []IndexPlanDoc) (string, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString("// createIndexes generated by keyhole --createIndex --dryRun, review before running\n")
+	namespaces := []string{}
+	specs := map[string][]string{}
+	for _, doc := range plan {
+		if doc.Action != indexCreate {
+			buffer.WriteString(fmt.Sprintf("// %v %v %v\n", doc.Action, doc.Namespace, getIndexDefinition(doc.Index)))
+			for _, str := range doc.Diffs {
+				buffer.WriteString("//     " + str + " (existing -> file)\n")
+			}
+			continue
+		}
+		data, err := bson.MarshalExtJSON(getIndexSpec(doc.Index), true, false)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := specs[doc.Namespace]; !ok {
+			namespaces = append(namespaces, doc.Namespace)
+		}
+		specs[doc.Namespace] = append(specs[doc.Namespace], fmt.Sprintf("EJSON.deserialize(%s, { relaxed: false })", data))
+	}
+	for _, ns := range namespaces {
+		i := strings.Index(ns, ".")
+		buffer.WriteString(fmt.Sprintf("\ndb.getSiblingDB(%q).runCommand({\n  createIndexes: %q,\n  indexes: [\n    %v\n  ]\n});\n",
+			ns[:i], ns[i+1:], strings.Join(specs[ns], ",\n    ")))
+	}
+	return buffer.String(), nil
+}
+
+// dryRunCreateIndexes prints indexes to create, skip, and conflict, and writes the mongosh script
+func (ix *Indexes) dryRunCreateIndexes() error {
+	plan, err := ix.GetCreateIndexesPlan()
+	if err != nil {
+		return err
+	}
+	fmt.Println(PrintCreateIndexesPlan(plan))
+	if ix.scriptFile == "" {
+		return nil
+	}
+	var script string
+	if script, err = getCreateIndexesScript(plan); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(ix.scriptFile, []byte(script), 0644); err == nil {
+		fmt.Println("mongosh script is written to", ix.scriptFile)
+	}
+	return err
+}
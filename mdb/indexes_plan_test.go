@@ -0,0 +1,52 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGetCreateIndexesPlan(t *testing.T) {
+	id := IndexStatsDoc{Name: "_id_", IndexKey: bson.D{{Key: "_id", Value: int32(1)}}}
+	indexesMap := map[string]CollectionIndexes{"keyhole": {
+		"cars": []IndexStatsDoc{id,
+			{Name: "vin_1", IndexKey: bson.D{{Key: "vin", Value: int32(1)}}, Unique: true},
+			{Name: "color_1_year_-1", IndexKey: bson.D{{Key: "color", Value: int32(1)}, {Key: "year", Value: int32(-1)}}},
+			{Name: "created_1", IndexKey: bson.D{{Key: "created", Value: int32(1)}}, ExpireAfterSeconds: 3600}},
+		"dealers": []IndexStatsDoc{id,
+			{Name: "name_1", IndexKey: bson.D{{Key: "name", Value: int32(1)}},
+				Collation: bson.D{{Key: "locale", Value: "en"}, {Key: "strength", Value: int32(2)}}},
+			{Name: "opened_1", IndexKey: bson.D{{Key: "opened", Value: int32(1)}},
+				PartialFilterExpression: bson.D{{Key: "opened", Value: bson.D{{Key: "$gt", Value: time.Unix(1577836800, 0)}}}}}}}}
+	existing := map[string]CollectionIndexes{"keyhole": {"cars": []IndexStatsDoc{id,
+		{Name: "vin_1", IndexKey: bson.D{{Key: "vin", Value: int32(1)}}},
+		{Name: "created", IndexKey: bson.D{{Key: "created", Value: int32(1)}}, ExpireAfterSeconds: 3600}}}}
+
+	plan := getCreateIndexesPlan(indexesMap, existing)
+	t.Log(PrintCreateIndexesPlan(plan))
+	actions := []string{}
+	for _, doc := range plan {
+		actions = append(actions, doc.Action)
+	}
+	if strings.Join(actions, ",") != "skip,conflict,create,conflict,skip,create,create" {
+		t.Fatal("unexpected actions", actions)
+	}
+	script, err := getCreateIndexesScript(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(script)
+	for _, str := range []string{`db.getSiblingDB("keyhole").runCommand({`, `createIndexes: "cars"`,
+		`EJSON.deserialize({"key":{"color":{"$numberInt":"1"},"year":{"$numberInt":"-1"}},"name":"color_1_year_-1"}, { relaxed: false })`,
+		`createIndexes: "dealers"`, `// skip keyhole.dealers { _id: 1 } _id_`,
+		`"collation":{"locale":"en","strength":{"$numberInt":"2"}}`, "// conflict keyhole.cars { vin: 1 } vin_1, unique",
+		`"partialFilterExpression":{"opened":{"$gt":{"$date":{"$numberLong":"1577836800000"}}}}`} {
+		if strings.Contains(script, str) == false {
+			t.Fatal("expected", str, "in script")
+		}
+	}
+}
@@ -0,0 +1,471 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// actions of retiring indexes
+const (
+	retireCommit   = "commit"
+	retireHide     = "hide"
+	retireRollback = "rollback"
+)
+
+// status of a retiring index
+const (
+	retireDropped  = "dropped"
+	retireFailed   = "failed"
+	retireHidden   = "hidden"
+	retireRefused  = "refused"
+	retireUnhidden = "unhidden"
+)
+
+// RetireIndexDoc stores a hidden index of the state file
+type RetireIndexDoc struct {
+	HiddenAt  time.Time  `json:"hiddenAt"`
+	Key       string     `json:"key"`
+	Name      string     `json:"name"`
+	Namespace string     `json:"namespace"`
+	Reason    string     `json:"reason"` // unused or duplicate
+	Status    string     `json:"status"` // hidden, failed to hide, unhidden, dropped, or refused
+	Error     string     `json:"error,omitempty"`
+	Usage     []UsageDoc `json:"usage"` // usage by host when hidden
+}
+
+// RetireStateDoc stores indexes hidden by keyhole --retire hide
+type RetireStateDoc struct {
+	Indexes []RetireIndexDoc `json:"indexes"`
+}
+
+// SetAutoMode sets to drop indexes without confirmation, and to hide unused indexes of restarted hosts
+func (ix *Indexes) SetAutoMode(auto bool) {
+	ix.auto = auto
+}
+
+// SetRetireStateFile sets the state file of hidden indexes
+func (ix *Indexes) SetRetireStateFile(filename string) {
+	ix.retireStateFile = filename
+}
+
+// SetWatchPeriod sets the time indexes stay hidden before they can be dropped
+func (ix *Indexes) SetWatchPeriod(watchPeriod time.Duration) {
+	ix.watchPeriod = watchPeriod
+}
+
+// RetireIndexes hides unused and duplicate indexes, unhides them to rollback, or drops them to commit
+func (ix *Indexes) RetireIndexes(action string) error {
+	switch action {
+	case retireHide:
+		return ix.hideIndexes()
+	case retireRollback:
+		return ix.unhideIndexes()
+	case retireCommit:
+		return ix.dropHiddenIndexes()
+	}
+	return fmt.Errorf("unsupported retire action %v, hide, rollback, or commit", action)
+}
+
+// hideIndexes hides unused and duplicate indexes with collMod, requires 4.4 or later
+func (ix *Indexes) hideIndexes() error {
+	var err error
+	if _, err = os.Stat(ix.retireStateFile); err == nil {
+		return fmt.Errorf("state file %v exists, rollback or commit first", ix.retireStateFile)
+	}
+	var info ServerInfo
+	if info, err = GetServerInfo(ix.client, true); err != nil {
+		return err
+	}
+	if isVersionAtLeast(info.Version, 4, 4) == false {
+		return fmt.Errorf("hidden indexes require 4.4 or later, but got %v", info.Version)
+	}
+	var indexesMap map[string]CollectionIndexes
+	if indexesMap, err = ix.GetIndexes(); err != nil {
+		return err
+	}
+	restarts := map[string]time.Time{}
+	if ix.auto == false {
+		restarts = getRestartedHosts(indexesMap, time.Now())
+	}
+	for _, str := range getIndexUsageWarnings(indexesMap, time.Now()) {
+		log.Println("warning:", str)
+	}
+	if len(restarts) > 0 {
+		log.Println("warning: skip unused indexes of restarted hosts, use --yes to hide them")
+	}
+	candidates := getRetireCandidates(indexesMap, restarts)
+	if len(candidates) == 0 {
+		fmt.Println("No unused or duplicate index to retire")
+		return nil
+	}
+	state := RetireStateDoc{}
+	for _, doc := range candidates { // saves after each collMod in case of interruptions
+		doc.HiddenAt = time.Now()
+		doc.Status = retireHidden
+		if err = ix.setIndexHidden(doc, true); err != nil {
+			doc.Status = retireFailed
+			doc.Error = err.Error()
+		}
+		state.Indexes = append(state.Indexes, doc)
+		if err = ix.writeRetireState(state); err != nil {
+			return err
+		}
+	}
+	fmt.Println(PrintRetireState(state))
+	return ix.saveRetireState(state)
+}
+
+// getRetireCandidates returns unused (?) and duplicate (x) indexes, _id, shard key, unique, and TTL
+// indexes are not retired, neither are unused indexes of restarted hosts, nor duplicates unless an
+// index covering them is used and kept
+func getRetireCandidates(indexesMap map[string]CollectionIndexes, restarts map[string]time.Time) []RetireIndexDoc {
+	candidates := []RetireIndexDoc{}
+	namespaces := getIndexesByNamespace(indexesMap)
+	keys := []string{}
+	for ns := range namespaces {
+		keys = append(keys, ns)
+	}
+	sort.Strings(keys)
+	for _, ns := range keys {
+		list := namespaces[ns]
+		reasons := make([]string, len(list))
+		for i, o := range list {
+			if o.Key == "{ _id: 1 }" || getRetireRefusal(o) != "" || o.IsDupped || o.TotalOps > 0 {
+				continue
+			}
+			reasons[i] = "unused"
+			for _, u := range o.Usage {
+				if _, ok := restarts[u.Host]; ok {
+					reasons[i] = ""
+				}
+			}
+		}
+		order := make([]int, 0, len(list)) // indexes of more fields first, they cover duplicates
+		for i := range list {
+			order = append(order, i)
+		}
+		sort.SliceStable(order, func(a, b int) bool { return len(list[order[a]].Fields) > len(list[order[b]].Fields) })
+		for _, i := range order {
+			o := list[i]
+			if o.IsDupped == false || o.Key == "{ _id: 1 }" || getRetireRefusal(o) != "" {
+				continue
+			}
+			for j, c := range list {
+				if j != i && reasons[j] == "" && c.TotalOps > 0 && isDuppedBy(o, c) {
+					reasons[i] = "duplicate"
+					break
+				}
+			}
+		}
+		for i, o := range list {
+			if reasons[i] != "" {
+				candidates = append(candidates, RetireIndexDoc{Key: o.Key, Name: o.Name, Namespace: ns,
+					Reason: reasons[i], Usage: o.Usage})
+			}
+		}
+	}
+	return candidates
+}
+
+// isDuppedBy returns true if an index has the same first field as another index, and all its
+// fields are in the other index, as in checkIfDupped
+func isDuppedBy(doc IndexStatsDoc, o IndexStatsDoc) bool {
+	if len(doc.Fields) == 0 || len(o.Fields) < len(doc.Fields) || doc.Fields[0] != o.Fields[0] || doc.Key == o.Key {
+		return false
+	}
+	for _, fld := range doc.Fields[1:] {
+		found := false
+		for _, field := range o.Fields[1:] {
+			if fld == field {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// getRetireRefusal returns why an index must not be dropped, or "" if it can be
+func getRetireRefusal(o IndexStatsDoc) string {
+	if o.IsShardKey {
+		return "shard key"
+	} else if o.Unique {
+		return "unique"
+	} else if o.ExpireAfterSeconds > 0 {
+		return "TTL"
+	}
+	return ""
+}
+
+// getHiddenUsage returns a host whose $indexStats shows the index used since hidden, or "", counters
+// of a host restarted since hidden, or not known when hidden, count usage while hidden only
+func getHiddenUsage(doc RetireIndexDoc, usage []UsageDoc) string {
+	for _, u := range usage {
+		ops := u.Accesses.Ops
+		for _, h := range doc.Usage {
+			if h.Host == u.Host && h.Accesses.Since.Equal(u.Accesses.Since) {
+				ops -= h.Accesses.Ops
+				break
+			}
+		}
+		if ops > 0 {
+			return fmt.Sprintf("%v, %d ops", u.Host, ops)
+		}
+	}
+	return ""
+}
+
+// unhideIndexes unhides indexes of the state file not yet dropped
+func (ix *Indexes) unhideIndexes() error {
+	state, err := ix.loadRetireState()
+	if err != nil {
+		return err
+	}
+	for i, doc := range state.Indexes {
+		if doc.Status != retireHidden && doc.Status != retireRefused {
+			continue
+		}
+		if err = ix.setIndexHidden(doc, false); err != nil {
+			state.Indexes[i].Error = err.Error()
+			continue
+		}
+		state.Indexes[i].Status = retireUnhidden
+		state.Indexes[i].Error = ""
+	}
+	fmt.Println(PrintRetireState(state))
+	return ix.saveRetireState(state)
+}
+
+// dropHiddenIndexes drops indexes of the state file hidden longer than the watch period, an index
+// is refused if used while hidden, no longer hidden, or a shard key, unique, or TTL index
+func (ix *Indexes) dropHiddenIndexes() error {
+	state, err := ix.loadRetireState()
+	if err != nil {
+		return err
+	}
+	ix.indexesMap = map[string]CollectionIndexes{}
+	for _, doc := range state.Indexes {
+		i := strings.Index(doc.Namespace, ".")
+		db, coll := doc.Namespace[:i], doc.Namespace[i+1:]
+		if ix.indexesMap[db] == nil {
+			ix.indexesMap[db] = CollectionIndexes{}
+		}
+		if _, ok := ix.indexesMap[db][coll]; !ok {
+			ix.indexesMap[db][coll] = ix.GetIndexesFromCollection(ix.client.Database(db).Collection(coll))
+		}
+	}
+	if ix.connString.String() != "" {
+		if err = ix.getMembersUsage(); err != nil {
+			return err
+		}
+	}
+	hidden := map[string]bool{}
+	for _, doc := range state.Indexes {
+		if doc.Status == retireHidden || doc.Status == retireRefused {
+			hidden[doc.Namespace+"."+doc.Name] = ix.isIndexHidden(doc)
+		}
+	}
+	state = getRetireDrops(state, getIndexesByNamespace(ix.indexesMap), hidden, ix.watchPeriod, time.Now())
+	drops := 0
+	for _, doc := range state.Indexes {
+		if doc.Status == retireHidden {
+			drops++
+		}
+	}
+	if drops > 0 && ix.auto == false {
+		fmt.Println(PrintRetireState(state))
+		reader := bufio.NewReader(os.Stdin)
+		fmt.Printf("Drop %d hidden indexes [y/N]: ", drops)
+		text, _ := reader.ReadString('\n')
+		text = strings.TrimSpace(text)
+		if text != "y" && text != "Y" {
+			return nil
+		}
+	}
+	for i, doc := range state.Indexes {
+		if doc.Status != retireHidden {
+			continue
+		}
+		j := strings.Index(doc.Namespace, ".")
+		cmd := bson.D{{Key: "dropIndexes", Value: doc.Namespace[j+1:]}, {Key: "index", Value: doc.Name}}
+		if err = ix.client.Database(doc.Namespace[:j]).RunCommand(context.Background(), cmd).Err(); err != nil {
+			state.Indexes[i].Error = err.Error()
+			continue
+		}
+		state.Indexes[i].Status = retireDropped
+	}
+	fmt.Println(PrintRetireState(state))
+	return ix.saveRetireState(state)
+}
+
+// getRetireDrops refuses dropping an index hidden within the watch period, used while hidden, no
+// longer hidden or found, or a shard key, unique, or TTL index, the others remain hidden to drop
+func getRetireDrops(state RetireStateDoc, namespaces map[string][]IndexStatsDoc, hidden map[string]bool,
+	watchPeriod time.Duration, now time.Time) RetireStateDoc {
+	for i, doc := range state.Indexes {
+		if doc.Status != retireHidden && doc.Status != retireRefused {
+			continue
+		}
+		var index *IndexStatsDoc
+		for j, o := range namespaces[doc.Namespace] {
+			if o.Name == doc.Name {
+				index = &namespaces[doc.Namespace][j]
+				break
+			}
+		}
+		refusal := ""
+		if index == nil {
+			refusal = "not found"
+		} else if hidden[doc.Namespace+"."+doc.Name] == false {
+			refusal = "not hidden"
+		} else if reason := getRetireRefusal(*index); reason != "" {
+			refusal = reason
+		} else if host := getHiddenUsage(doc, index.Usage); host != "" {
+			refusal = "used while hidden on " + host
+		} else if now.Sub(doc.HiddenAt) < watchPeriod {
+			refusal = fmt.Sprintf("hidden for %v, less than %v", now.Sub(doc.HiddenAt).Round(time.Hour), watchPeriod)
+		}
+		state.Indexes[i].Error = refusal
+		state.Indexes[i].Status = retireHidden
+		if refusal != "" {
+			state.Indexes[i].Status = retireRefused
+		}
+	}
+	return state
+}
+
+// setIndexHidden hides or unhides an index with collMod
+func (ix *Indexes) setIndexHidden(doc RetireIndexDoc, hidden bool) error {
+	i := strings.Index(doc.Namespace, ".")
+	cmd := bson.D{{Key: "collMod", Value: doc.Namespace[i+1:]},
+		{Key: "index", Value: bson.D{{Key: "name", Value: doc.Name}, {Key: "hidden", Value: hidden}}}}
+	if ix.verbose {
+		log.Println("collMod", doc.Namespace, doc.Name, "hidden:", hidden)
+	}
+	return ix.client.Database(doc.Namespace[:i]).RunCommand(context.Background(), cmd).Err()
+}
+
+// isIndexHidden returns true if listIndexes shows the index hidden
+func (ix *Indexes) isIndexHidden(doc RetireIndexDoc) bool {
+	var ctx = context.Background()
+	i := strings.Index(doc.Namespace, ".")
+	cur, err := ix.client.Database(doc.Namespace[:i]).Collection(doc.Namespace[i+1:]).Indexes().List(ctx)
+	if err != nil {
+		return false
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var spec bson.M
+		if err = cur.Decode(&spec); err == nil && spec["name"] == doc.Name {
+			hidden, _ := spec["hidden"].(bool)
+			return hidden
+		}
+	}
+	return false
+}
+
+// isVersionAtLeast returns true if a version, for example 4.4.1, is major.minor or later
+func isVersionAtLeast(version string, major int, minor int) bool {
+	nums := strings.Split(version, ".")
+	if len(nums) < 2 {
+		return false
+	}
+	ma, _ := strconv.Atoi(nums[0])
+	mi, _ := strconv.Atoi(nums[1])
+	return ma > major || (ma == major && mi >= minor)
+}
+
+// loadRetireState reads the state file of hidden indexes
+func (ix *Indexes) loadRetireState() (RetireStateDoc, error) {
+	var state RetireStateDoc
+	data, err := ioutil.ReadFile(ix.retireStateFile)
+	if err != nil {
+		return state, err
+	}
+	if err = json.Unmarshal(data, &state); err != nil {
+		return state, err
+	}
+	if len(state.Indexes) == 0 {
+		return state, errors.New("no hidden index in " + ix.retireStateFile)
+	}
+	return state, nil
+}
+
+// saveRetireState writes the state file of hidden indexes, or archives it with a timestamp suffix
+// if no index is left hidden so that the next hide can begin
+func (ix *Indexes) saveRetireState(state RetireStateDoc) error {
+	err := ix.writeRetireState(state)
+	if err != nil {
+		return err
+	}
+	if hasHiddenIndexes(state) {
+		fmt.Println("Retire state is written to", ix.retireStateFile)
+		return nil
+	}
+	filename := ix.retireStateFile + "." + time.Now().Format("20060102150405")
+	if err = os.Rename(ix.retireStateFile, filename); err == nil {
+		fmt.Println("No index is left hidden, retire state is archived to", filename)
+	}
+	return err
+}
+
+// writeRetireState writes the state file of hidden indexes
+func (ix *Indexes) writeRetireState(state RetireStateDoc) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ix.retireStateFile, data, 0644)
+}
+
+// hasHiddenIndexes returns true if an index of the state is hidden, to drop or refused to drop
+func hasHiddenIndexes(state RetireStateDoc) bool {
+	for _, doc := range state.Indexes {
+		if doc.Status == retireHidden || doc.Status == retireRefused {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintRetireState returns status of indexes of the state file by namespace
+func PrintRetireState(state RetireStateDoc) string {
+	counts := map[string]int{}
+	for _, doc := range state.Indexes {
+		counts[doc.Status]++
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Retire indexes, %d hidden, %d unhidden, %d dropped, %d refused, %d failed\n",
+		counts[retireHidden], counts[retireUnhidden], counts[retireDropped], counts[retireRefused], counts[retireFailed]))
+	ns := ""
+	for _, doc := range state.Indexes {
+		if doc.Namespace != ns {
+			ns = doc.Namespace
+			buffer.WriteString("\n" + ns + ":\n")
+		}
+		str := fmt.Sprintf("  %-9s %v %v (%v)", doc.Status, doc.Key, doc.Name, doc.Reason)
+		if doc.Error != "" {
+			str += ", " + doc.Error
+		}
+		buffer.WriteString(str + "\n")
+	}
+	return buffer.String()
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetRetireCandidates(t *testing.T) {
+	now := time.Now()
+	restarted := []UsageDoc{{Host: "h2:27017", Accesses: AccessesDoc{Since: now.Add(-time.Hour)}}}
+	indexesMap := map[string]CollectionIndexes{"keyhole": {"cars": []IndexStatsDoc{
+		{Key: "{ _id: 1 }", Name: "_id_", Fields: []string{"_id"}},
+		{Key: "{ color: 1 }", Name: "color_1", Fields: []string{"color"}, IsDupped: true, TotalOps: 10},
+		{Key: "{ color: 1, brand: 1 }", Name: "color_1_brand_1", Fields: []string{"color", "brand"}, TotalOps: 10},
+		{Key: "{ year: 1 }", Name: "year_1", Fields: []string{"year"}},
+		{Key: "{ model: 1 }", Name: "model_1", Fields: []string{"model"}, Usage: restarted},
+		{Key: "{ vin: 1 }", Name: "vin_1", Fields: []string{"vin"}, Unique: true},
+		{Key: "{ updated: 1 }", Name: "updated_1", Fields: []string{"updated"}, ExpireAfterSeconds: 3600},
+		{Key: "{ dealer: 1 }", Name: "dealer_1", Fields: []string{"dealer"}, IsShardKey: true},
+	}}}
+	restarts := getRestartedHosts(indexesMap, now)
+	candidates := getRetireCandidates(indexesMap, restarts)
+	if len(candidates) != 2 || candidates[0].Name != "color_1" || candidates[0].Reason != "duplicate" ||
+		candidates[1].Name != "year_1" || candidates[1].Reason != "unused" {
+		t.Fatal("expected color_1 and year_1, but got", candidates)
+	}
+	if candidates = getRetireCandidates(indexesMap, nil); len(candidates) != 3 || candidates[2].Name != "model_1" {
+		t.Fatal("expected model_1 of a restarted host with --yes, but got", candidates)
+	}
+}
+
+func TestGetRetireCandidatesCovered(t *testing.T) {
+	// the planner picks the shorter index, the covering index shows 0 ops
+	indexesMap := map[string]CollectionIndexes{"keyhole": {"cars": []IndexStatsDoc{
+		{Key: "{ color: 1 }", Name: "color_1", Fields: []string{"color"}, IsDupped: true, TotalOps: 10},
+		{Key: "{ color: 1, brand: 1 }", Name: "color_1_brand_1", Fields: []string{"color", "brand"}},
+		{Key: "{ brand: 1 }", Name: "brand_1", Fields: []string{"brand"}, IsDupped: true},
+		{Key: "{ brand: 1, year: 1 }", Name: "brand_1_year_1", Fields: []string{"brand", "year"}, IsDupped: true,
+			TotalOps: 5},
+		{Key: "{ brand: 1, year: 1, model: 1 }", Name: "brand_1_year_1_model_1",
+			Fields: []string{"brand", "year", "model"}, TotalOps: 5},
+	}}}
+	names := []string{}
+	for _, doc := range getRetireCandidates(indexesMap, nil) {
+		names = append(names, doc.Name+" "+doc.Reason)
+	}
+	if strings.Join(names, ",") != "color_1_brand_1 unused,brand_1 duplicate,brand_1_year_1 duplicate" {
+		t.Fatal("expected color_1 kept as its covering index is unused, but got", names)
+	}
+}
+
+func TestGetRetireDrops(t *testing.T) {
+	now := time.Now()
+	hiddenAt := now.Add(-10 * 24 * time.Hour)
+	since := now.Add(-30 * 24 * time.Hour)
+	state := RetireStateDoc{Indexes: []RetireIndexDoc{
+		{HiddenAt: hiddenAt, Name: "color_1", Namespace: "keyhole.cars", Status: retireHidden,
+			Usage: []UsageDoc{{Host: "h1:27017", Accesses: AccessesDoc{Ops: 10, Since: since}}}},
+		{HiddenAt: hiddenAt, Name: "year_1", Namespace: "keyhole.cars", Status: retireHidden,
+			Usage: []UsageDoc{{Host: "h1:27017", Accesses: AccessesDoc{Ops: 0, Since: since}}}},
+		{HiddenAt: hiddenAt, Name: "vin_1", Namespace: "keyhole.cars", Status: retireHidden},
+		{HiddenAt: now.Add(-time.Hour), Name: "brand_1", Namespace: "keyhole.cars", Status: retireHidden},
+		{HiddenAt: hiddenAt, Name: "model_1", Namespace: "keyhole.cars", Status: retireHidden},
+		{HiddenAt: hiddenAt, Name: "dealer_1", Namespace: "keyhole.cars", Status: retireDropped},
+	}}
+	namespaces := map[string][]IndexStatsDoc{"keyhole.cars": {
+		{Name: "color_1", Usage: []UsageDoc{{Host: "h1:27017", Accesses: AccessesDoc{Ops: 10, Since: since}}}},
+		{Name: "year_1", Usage: []UsageDoc{{Host: "h1:27017", Accesses: AccessesDoc{Ops: 3, Since: since}}}},
+		{Name: "vin_1", Unique: true},
+		{Name: "brand_1"},
+	}}
+	hidden := map[string]bool{"keyhole.cars.color_1": true, "keyhole.cars.year_1": true, "keyhole.cars.vin_1": true,
+		"keyhole.cars.brand_1": true}
+	state = getRetireDrops(state, namespaces, hidden, 7*24*time.Hour, now)
+	str := PrintRetireState(state)
+	t.Log(str)
+	expected := []string{retireHidden, retireRefused, retireRefused, retireRefused, retireRefused, retireDropped}
+	for i, doc := range state.Indexes {
+		if doc.Status != expected[i] {
+			t.Fatal("expected", expected[i], "of", doc.Name, "but got", doc.Status, doc.Error)
+		}
+	}
+	if state.Indexes[1].Error != "used while hidden on h1:27017, 3 ops" || state.Indexes[2].Error != "unique" ||
+		state.Indexes[4].Error != "not found" {
+		t.Fatal("unexpected refusals", state.Indexes)
+	}
+	if strings.HasPrefix(str, "Retire indexes, 1 hidden, 0 unhidden, 1 dropped, 4 refused, 0 failed") == false {
+		t.Fatal("unexpected summary", str)
+	}
+	if hasHiddenIndexes(state) == false {
+		t.Fatal("expected hidden indexes")
+	}
+	for i := range state.Indexes {
+		if state.Indexes[i].Status != retireDropped {
+			state.Indexes[i].Status = retireUnhidden
+		}
+	}
+	if hasHiddenIndexes(state) == true {
+		t.Fatal("expected no hidden index left")
+	}
+}
+
+func TestIsVersionAtLeast(t *testing.T) {
+	if isVersionAtLeast("4.4.1", 4, 4) == false || isVersionAtLeast("5.0.0", 4, 4) == false ||
+		isVersionAtLeast("4.2.8", 4, 4) == true || isVersionAtLeast("", 4, 4) == true {
+		t.Fatal("unexpected version comparison")
+	}
+}
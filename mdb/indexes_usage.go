@@ -0,0 +1,257 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+)
+
+// indexUsageMinUptime is the time since a restart before usage counters of a member are trusted
+const indexUsageMinUptime = 7 * 24 * time.Hour
+
+// SetConnString sets connString to connect to every data-bearing member for index usage
+func (ix *Indexes) SetConnString(connString connstring.ConnString) {
+	ix.connString = connString
+}
+
+// SetTLSFiles sets TLS CA file and client certificate key file of members
+func (ix *Indexes) SetTLSFiles(caFile string, certificateKeyFile string) {
+	ix.files = []string{caFile, certificateKeyFile}
+}
+
+// getMembersUsage merges $indexStats of every data-bearing member, of every shard of a sharded
+// cluster, into usage of indexes by host
+func (ix *Indexes) getMembersUsage() error {
+	var err error
+	var info ServerInfo
+	if info, err = GetServerInfo(ix.client, true); err != nil {
+		return err
+	}
+	var members []string
+	if info.Cluster == SHARDED {
+		var shardList []string
+		if shardList, err = GetShardListWithURI(ix.client, ix.connString.String()); err != nil {
+			return err
+		}
+		for _, shardURI := range shardList {
+			var client *mongo.Client
+			if client, err = NewMongoClient(shardURI, ix.files...); err != nil {
+				log.Println("usage of shard", redactURI(shardURI), "not collected:", err)
+				continue
+			}
+			hosts, e := getDataBearingMembers(client)
+			client.Disconnect(context.Background())
+			if e != nil {
+				log.Println("usage of shard", redactURI(shardURI), "not collected:", e)
+				continue
+			}
+			for _, host := range hosts {
+				members = append(members, getMemberURI(shardURI, host))
+			}
+		}
+	} else if info.Cluster == REPLICA {
+		var hosts []string
+		if hosts, err = getDataBearingMembers(ix.client); err != nil {
+			return err
+		}
+		for _, host := range hosts {
+			members = append(members, getMemberURI(ix.connString.String(), host))
+		}
+	}
+	for _, member := range members {
+		if err = ix.mergeMemberUsage(member); err != nil {
+			log.Println("usage of", redactURI(member), "not collected:", err)
+		}
+	}
+	return nil
+}
+
+// mergeMembersUsage merges usage of members if they can be listed, usage of the connected server is
+// kept otherwise, for example without the clusterMonitor role
+func (ix *Indexes) mergeMembersUsage() {
+	if err := ix.getMembersUsage(); err != nil {
+		log.Println("usage of members not collected, usage of the connected server only:", err)
+	}
+}
+
+// getDataBearingMembers returns hosts of primary and secondaries from replSetGetStatus, arbiters
+// and members in other states have no usage to collect
+func getDataBearingMembers(client *mongo.Client) ([]string, error) {
+	status, err := RunAdminCommand(client, "replSetGetStatus")
+	if err != nil {
+		return nil, err
+	}
+	hosts := []string{}
+	members, _ := status["members"].(bson.A)
+	for _, m := range members {
+		member, ok := m.(bson.M)
+		if !ok {
+			continue
+		}
+		if state := toInt(member["state"]); state == 1 || state == 2 {
+			hosts = append(hosts, fmt.Sprintf("%v", member["name"]))
+		}
+	}
+	return hosts, nil
+}
+
+// getMemberURI returns a URI of a direct connection to a member, hosts and replicaSet of the
+// URI are replaced with the member, mongodb+srv uses ssl and authSource admin as SRV implies
+func getMemberURI(uri string, host string) string {
+	isSRV := strings.HasPrefix(uri, "mongodb+srv://")
+	rest := uri[strings.Index(uri, "://")+3:]
+	credentials := ""
+	hosts := rest
+	query := ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		hosts = rest[:i]
+		query = rest[i+1:]
+	} else if i = strings.Index(rest, "?"); i >= 0 {
+		hosts = rest[:i]
+		query = rest[i:]
+	}
+	if i := strings.LastIndex(hosts, "@"); i >= 0 {
+		credentials = hosts[:i+1]
+	}
+	db := query
+	params := []string{}
+	if i := strings.Index(query, "?"); i >= 0 {
+		db = query[:i]
+		for _, param := range strings.Split(query[i+1:], "&") {
+			if param != "" && strings.HasPrefix(strings.ToLower(param), "replicaset=") == false {
+				params = append(params, param)
+			}
+		}
+	}
+	if isSRV {
+		if strings.Contains(strings.ToLower(query), "authsource=") == false {
+			params = append(params, "authSource=admin")
+		}
+		if strings.Contains(strings.ToLower(query), "ssl=") == false && strings.Contains(strings.ToLower(query), "tls=") == false {
+			params = append(params, "ssl=true")
+		}
+	}
+	ruri := "mongodb://" + credentials + host + "/" + db
+	if len(params) > 0 {
+		ruri += "?" + strings.Join(params, "&")
+	}
+	return ruri
+}
+
+// mergeMemberUsage merges $indexStats of collections of indexes map from a member
+func (ix *Indexes) mergeMemberUsage(uri string) error {
+	client, err := NewMongoClient(uri, ix.files...)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+	if ix.verbose {
+		log.Println("collecting usage from", redactURI(uri))
+	}
+	for db, collections := range ix.indexesMap {
+		for coll, list := range collections {
+			usages, err := getIndexStatsUsage(client.Database(db).Collection(coll))
+			if err != nil {
+				return err
+			}
+			for i := range list {
+				for _, usage := range usages[list[i].Name] {
+					mergeIndexUsage(&list[i], usage)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// getIndexStatsUsage returns usage of indexes of a collection by index name
+func getIndexStatsUsage(collection *mongo.Collection) (map[string][]UsageDoc, error) {
+	var ctx = context.Background()
+	usages := map[string][]UsageDoc{}
+	cur, err := collection.Aggregate(ctx, MongoPipeline(`{"$indexStats": {}}`))
+	if err != nil {
+		return usages, err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var result bson.M
+		if err = cur.Decode(&result); err != nil {
+			continue
+		}
+		b, _ := bson.Marshal(result)
+		var usage UsageDoc
+		bson.Unmarshal(b, &usage)
+		name := fmt.Sprintf("%v", result["name"])
+		usages[name] = append(usages[name], usage)
+	}
+	return usages, nil
+}
+
+// mergeIndexUsage merges usage of a host into an index, replacing usage of the same host, for
+// example of the primary already read through the client
+func mergeIndexUsage(o *IndexStatsDoc, usage UsageDoc) {
+	found := false
+	for i, u := range o.Usage {
+		if u.Host == usage.Host {
+			o.Usage[i] = usage
+			found = true
+			break
+		}
+	}
+	if !found {
+		o.Usage = append(o.Usage, usage)
+	}
+	sort.Slice(o.Usage, func(i, j int) bool { return o.Usage[i].Host < o.Usage[j].Host })
+	o.TotalOps = 0
+	for _, u := range o.Usage {
+		o.TotalOps += u.Accesses.Ops
+	}
+}
+
+// getRestartedHosts returns when each host restarted within indexUsageMinUptime, the earliest since
+// of indexes of a host is when its counters were reset
+func getRestartedHosts(indexesMap map[string]CollectionIndexes, now time.Time) map[string]time.Time {
+	restarts := map[string]time.Time{}
+	for _, collections := range indexesMap {
+		for _, list := range collections {
+			for _, o := range list {
+				for _, u := range o.Usage {
+					if since, ok := restarts[u.Host]; !ok || u.Accesses.Since.Before(since) {
+						restarts[u.Host] = u.Accesses.Since
+					}
+				}
+			}
+		}
+	}
+	for host, since := range restarts {
+		if since.IsZero() || now.Sub(since) >= indexUsageMinUptime {
+			delete(restarts, host)
+		}
+	}
+	return restarts
+}
+
+// getIndexUsageWarnings returns a warning of each host restarted within indexUsageMinUptime
+func getIndexUsageWarnings(indexesMap map[string]CollectionIndexes, now time.Time) []string {
+	restarts := getRestartedHosts(indexesMap, now)
+	hosts := []string{}
+	for host := range restarts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	warnings := []string{}
+	for _, host := range hosts {
+		warnings = append(warnings, fmt.Sprintf("%v restarted at %v, usage of %v only, unused indexes (?) may be used",
+			host, restarts[host].Format(time.RFC3339), now.Sub(restarts[host]).Round(time.Hour)))
+	}
+	return warnings
+}
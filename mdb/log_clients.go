@@ -0,0 +1,311 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// topApps is the number of client apps printed of a query pattern
+const topApps = 5
+
+// AppPerformanceDoc stores performance data of a query pattern from a client app
+type AppPerformanceDoc struct {
+	App        string `json:"app" bson:"app"`               // appName
+	Count      int    `json:"count" bson:"count"`           // number of ops
+	Driver     string `json:"driver" bson:"driver"`         // driver name and version
+	MaxMilli   int    `json:"maxmilli" bson:"maxmilli"`     // max millisecond
+	Remote     string `json:"remote" bson:"remote"`         // client IP
+	TotalMilli int    `json:"totalmilli" bson:"totalmilli"` // total milliseconds
+}
+
+// ClientsDoc summarizes client apps, drivers, and connection churn
+type ClientsDoc struct {
+	Accepted int            `json:"accepted" bson:"accepted"` // connections accepted
+	Apps     map[string]int `json:"apps" bson:"apps"`         // connections by appName
+	Churn    []ChurnDoc     `json:"churn" bson:"churn"`       // connections accepted and ended per minute
+	Drivers  map[string]int `json:"drivers" bson:"drivers"`   // connections by driver name and version
+	Ended    int            `json:"ended" bson:"ended"`       // connections ended
+	MaxOpen  int            `json:"maxopen" bson:"maxopen"`   // max connections open
+}
+
+// ChurnDoc stores connections accepted and ended in a minute
+type ChurnDoc struct {
+	Accepted int       `json:"accepted" bson:"accepted"` // connections accepted
+	Ended    int       `json:"ended" bson:"ended"`       // connections ended
+	Minute   time.Time `json:"minute" bson:"minute"`     // beginning of the minute
+}
+
+// clientInfo holds the client of a connection
+type clientInfo struct {
+	app    string
+	driver string
+	remote string
+}
+
+// logClient holds a connection accepted, client metadata, or connection ended line
+type logClient struct {
+	client clientInfo
+	conn   string // connection context, for example conn12
+	event  string // accepted, metadata, or ended
+	open   int    // connections now open
+	time   time.Time
+}
+
+const (
+	clientAccepted = "accepted"
+	clientEnded    = "ended"
+	clientMetadata = "metadata"
+)
+
+var acceptedRegex = regexp.MustCompile(`^connection accepted from (\S+) #(\d+) \((\d+) connections? now open\)`)
+var metadataRegex = regexp.MustCompile(`^received client metadata from (\S+) (conn\d+): (.*)$`)
+var endedRegex = regexp.MustCompile(`^end connection (\S+) \((\d+) connections? now open\)`)
+
+// getLogClient returns a connection accepted, client metadata, or connection ended of a line, or nil
+func getLogClient(line logLine) *logClient {
+	if line.component != "NETWORK" {
+		return nil
+	}
+	if line.attrs != nil {
+		return getLogv2Client(line)
+	}
+	if result := acceptedRegex.FindStringSubmatch(line.message); result != nil {
+		open, _ := strconv.Atoi(result[3])
+		return &logClient{client: clientInfo{remote: getClientIP(result[1])}, conn: "conn" + result[2],
+			event: clientAccepted, open: open, time: line.time}
+	} else if result := metadataRegex.FindStringSubmatch(line.message); result != nil {
+		doc, _ := parseLogDoc(result[3]).(logDoc)
+		driver := doc.getDoc("driver")
+		name, _ := driver.get("name").(logScalar)
+		version, _ := driver.get("version").(logScalar)
+		app, _ := doc.getDoc("application").get("name").(logScalar)
+		return &logClient{client: clientInfo{app: app.raw, driver: strings.TrimSpace(name.raw + " " + version.raw),
+			remote: getClientIP(result[1])}, conn: result[2], event: clientMetadata, time: line.time}
+	} else if result := endedRegex.FindStringSubmatch(line.message); result != nil {
+		open, _ := strconv.Atoi(result[2])
+		return &logClient{client: clientInfo{remote: getClientIP(result[1])}, conn: line.context, event: clientEnded,
+			open: open, time: line.time}
+	}
+	return nil
+}
+
+// getLogv2Client returns a connection accepted, client metadata, or connection ended of a logv2 line, or nil
+func getLogv2Client(line logLine) *logClient {
+	remote, _ := line.attrs["remote"].(string)
+	lc := logClient{client: clientInfo{remote: getClientIP(remote)}, conn: line.context, open: toInt(line.attrs["connectionCount"]),
+		time: line.time}
+	switch line.message {
+	case "Connection accepted":
+		lc.conn = fmt.Sprintf("conn%v", toInt(line.attrs["connectionId"]))
+		lc.event = clientAccepted
+	case "client metadata":
+		lc.event = clientMetadata
+		doc, _ := line.attrs["doc"].(map[string]interface{})
+		if driver, ok := doc["driver"].(map[string]interface{}); ok {
+			lc.client.driver = strings.TrimSpace(fmt.Sprintf("%v %v", driver["name"], driver["version"]))
+		}
+		if app, ok := doc["application"].(map[string]interface{}); ok && app["name"] != nil {
+			lc.client.app = fmt.Sprintf("%v", app["name"])
+		}
+	case "Connection ended":
+		lc.event = clientEnded
+	default:
+		return nil
+	}
+	return &lc
+}
+
+// getClientIP returns IP of a remote host:port
+func getClientIP(remote string) string {
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		return host
+	}
+	return remote
+}
+
+// addClient adds a connection of the current host to the clients summary
+func (li *LogInfo) addClient(lc logClient) {
+	if li.clientsMap == nil {
+		li.clientsMap = map[string]clientInfo{}
+		li.churnMap = map[time.Time]ChurnDoc{}
+	}
+	doc := &li.Clients
+	if doc.Apps == nil {
+		doc.Apps = map[string]int{}
+		doc.Drivers = map[string]int{}
+	}
+	li.setConnClient(lc)
+	minute := lc.time.Truncate(time.Minute)
+	churn := li.churnMap[minute]
+	churn.Minute = minute
+	switch lc.event {
+	case clientAccepted:
+		doc.Accepted++
+		churn.Accepted++
+	case clientMetadata:
+		if lc.client.app != "" {
+			doc.Apps[lc.client.app]++
+		}
+		if lc.client.driver != "" {
+			doc.Drivers[lc.client.driver]++
+		}
+	case clientEnded:
+		doc.Ended++
+		churn.Ended++
+	}
+	if lc.event != clientMetadata && lc.time.IsZero() == false {
+		li.churnMap[minute] = churn
+	}
+	if lc.open > doc.MaxOpen {
+		doc.MaxOpen = lc.open
+	}
+}
+
+// setConnClient keeps the client of a connection of the current host until the connection ends
+func (li *LogInfo) setConnClient(lc logClient) {
+	if li.clientsMap == nil {
+		li.clientsMap = map[string]clientInfo{}
+	}
+	key := li.host + "/" + lc.conn
+	switch lc.event {
+	case clientAccepted, clientMetadata:
+		li.clientsMap[key] = lc.client
+	case clientEnded:
+		delete(li.clientsMap, key)
+	}
+}
+
+// getClient returns the client of an op, from its own appName and remote, or from its connection
+func (li *LogInfo) getClient(stat LogStats) clientInfo {
+	client := li.clientsMap[li.host+"/"+stat.conn]
+	if stat.app != "" {
+		client.app = stat.app
+	}
+	if stat.remote != "" {
+		client.remote = getClientIP(stat.remote)
+	}
+	return client
+}
+
+// addApp adds an op to the breakdown of its client app
+func (doc *OpPerformanceDoc) addApp(client clientInfo, milli int) {
+	for i, a := range doc.Apps {
+		if a.App == client.app && a.Driver == client.driver && a.Remote == client.remote {
+			doc.Apps[i].Count++
+			doc.Apps[i].TotalMilli += milli
+			if milli > a.MaxMilli {
+				doc.Apps[i].MaxMilli = milli
+			}
+			return
+		}
+	}
+	doc.Apps = append(doc.Apps, AppPerformanceDoc{App: client.app, Count: 1, Driver: client.driver, MaxMilli: milli,
+		Remote: client.remote, TotalMilli: milli})
+}
+
+// getTopApps returns the topApps client apps of the most time, the rest are summed up as others
+func getTopApps(apps []AppPerformanceDoc) []AppPerformanceDoc {
+	if len(apps) <= topApps {
+		return apps
+	}
+	tops := append([]AppPerformanceDoc{}, apps...)
+	sort.SliceStable(tops, func(i, j int) bool { return tops[i].TotalMilli > tops[j].TotalMilli })
+	others := AppPerformanceDoc{App: fmt.Sprintf("%d others", len(tops)-topApps)}
+	for _, app := range tops[topApps:] {
+		others.Count += app.Count
+		others.TotalMilli += app.TotalMilli
+		if app.MaxMilli > others.MaxMilli {
+			others.MaxMilli = app.MaxMilli
+		}
+	}
+	return append(tops[:topApps], others)
+}
+
+// mergeApps merges client app breakdowns of the same query pattern
+func mergeApps(a []AppPerformanceDoc, b []AppPerformanceDoc) []AppPerformanceDoc {
+	apps := append([]AppPerformanceDoc{}, a...)
+	for _, app := range b {
+		found := false
+		for i := range apps {
+			if apps[i].App == app.App && apps[i].Driver == app.Driver && apps[i].Remote == app.Remote {
+				apps[i].Count += app.Count
+				apps[i].TotalMilli += app.TotalMilli
+				if app.MaxMilli > apps[i].MaxMilli {
+					apps[i].MaxMilli = app.MaxMilli
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			apps = append(apps, app)
+		}
+	}
+	return apps
+}
+
+// setClients sets connection churn in chronological order
+func (li *LogInfo) setClients() {
+	li.Clients.Churn = make([]ChurnDoc, 0, len(li.churnMap))
+	for _, churn := range li.churnMap {
+		li.Clients.Churn = append(li.Clients.Churn, churn)
+	}
+	sort.Slice(li.Clients.Churn, func(i, j int) bool { return li.Clients.Churn[i].Minute.Before(li.Clients.Churn[j].Minute) })
+}
+
+// getAppString returns client app, driver, and IP of a breakdown, for example orders (nodejs 3.6.0) 10.0.0.7
+func getAppString(app AppPerformanceDoc) string {
+	strs := []string{}
+	if app.App != "" {
+		strs = append(strs, app.App)
+	}
+	if app.Driver != "" {
+		strs = append(strs, "("+app.Driver+")")
+	}
+	if app.Remote != "" {
+		strs = append(strs, app.Remote)
+	}
+	return strings.Join(strs, " ")
+}
+
+// printClients prints client apps, drivers, and the busiest minutes of connection churn
+func (li *LogInfo) printClients() string {
+	doc := li.Clients
+	if doc.Accepted == 0 && len(doc.Drivers) == 0 {
+		return ""
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Connections: %d accepted, %d ended, max %d open\n", doc.Accepted, doc.Ended, doc.MaxOpen))
+	if len(doc.Drivers) > 0 {
+		buffer.WriteString(fmt.Sprintf("  drivers: %v\n", getSortedCounts(doc.Drivers)))
+	}
+	if len(doc.Apps) > 0 {
+		buffer.WriteString(fmt.Sprintf("  apps: %v\n", getSortedCounts(doc.Apps)))
+	}
+	if len(doc.Churn) > 0 {
+		minutes := float64(doc.Churn[len(doc.Churn)-1].Minute.Sub(doc.Churn[0].Minute)/time.Minute + 1)
+		buffer.WriteString(fmt.Sprintf("  avg per minute: %.1f accepted, %.1f ended\n",
+			float64(doc.Accepted)/minutes, float64(doc.Ended)/minutes))
+		busiest := append([]ChurnDoc{}, doc.Churn...)
+		sort.SliceStable(busiest, func(i, j int) bool {
+			return busiest[i].Accepted+busiest[i].Ended > busiest[j].Accepted+busiest[j].Ended
+		})
+		if len(busiest) > 5 {
+			busiest = busiest[:5]
+		}
+		buffer.WriteString("  busiest minutes:\n")
+		for _, churn := range busiest {
+			buffer.WriteString(fmt.Sprintf("    %v accepted %d, ended %d\n", churn.Minute.UTC().Format(time.RFC3339),
+				churn.Accepted, churn.Ended))
+		}
+	}
+	return buffer.String()
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// LogEvent stores a replica set, election, or sharding event
+type LogEvent struct {
+	Component string    `json:"component" bson:"component"` // REPL, ELECTION, SHARDING, etc
+	Count     int       `json:"count" bson:"count"`         // number of repeated events
+	Host      string    `json:"host" bson:"host"`           // host:port or log file name
+	Last      time.Time `json:"last" bson:"last"`           // time of last repeated event
+	Message   string    `json:"message" bson:"message"`     // log message
+	Time      time.Time `json:"time" bson:"time"`           // time of event
+	Type      string    `json:"type" bson:"type"`           // election, heartbeat, rollback, sharding, state, or syncSource
+}
+
+const maxEventMessage = 256
+
+var eventComponents = map[string]bool{"ELECTION": true, "REPL": true, "REPL_HB": true, "ROLLBACK": true, "SHARDING": true}
+
+// eventRules classifies messages in the order listed, sharding rules apply to SHARDING component only
+var eventRules = []struct {
+	eventType string
+	regex     *regexp.Regexp
+	sharding  bool
+}{
+	{"state", regexp.MustCompile(`(?i)transition to \w+|state transition`), false},
+	{"election", regexp.MustCompile(`(?i)election|stepping down|stepped down|step ?down|dry run`), false},
+	{"heartbeat", regexp.MustCompile(`(?i)heartbeat.*(fail|error|timeout|timed out)|(fail|error).*heartbeat`), false},
+	{"syncSource", regexp.MustCompile(`(?i)sync source|syncing from`), false},
+	{"rollback", regexp.MustCompile(`(?i)rollback`), false},
+	{"sharding", regexp.MustCompile(`(?i)movechunk|migration|split|balancer`), true},
+}
+
+// SetEvents sets to print replica set and sharding events
+func (li *LogInfo) SetEvents(events bool) {
+	li.showEvents = events
+}
+
+// getLogEvent returns a replica set, election, or sharding event of a line, or nil
+func getLogEvent(line logLine) *LogEvent {
+	if eventComponents[line.component] == false {
+		return nil
+	}
+	message := line.message
+	if line.attr != "" {
+		message += " " + line.attr
+	}
+	for _, rule := range eventRules {
+		if rule.sharding != (line.component == "SHARDING") || rule.regex.MatchString(message) == false {
+			continue
+		}
+		if len(message) > maxEventMessage {
+			message = message[:maxEventMessage-3] + "..."
+		}
+		return &LogEvent{Component: line.component, Count: 1, Last: line.time, Message: message, Time: line.time,
+			Type: rule.eventType}
+	}
+	return nil
+}
+
+// addEvent adds an event of the current host, repeated events are counted
+func (li *LogInfo) addEvent(event LogEvent) {
+	event.Host = li.host
+	if n := len(li.Events); n > 0 {
+		last := &li.Events[n-1]
+		if last.Host == event.Host && last.Type == event.Type && last.Message == event.Message {
+			last.Count++
+			last.Last = event.Time
+			return
+		}
+	}
+	li.Events = append(li.Events, event)
+}
+
+// setEvents sorts events of all hosts by time
+func (li *LogInfo) setEvents() {
+	sort.SliceStable(li.Events, func(i, j int) bool { return li.Events[i].Time.Before(li.Events[j].Time) })
+}
+
+// printEvents prints replica set and sharding events in chronological order
+func (li *LogInfo) printEvents() string {
+	if len(li.Events) == 0 {
+		return ""
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Replica set and sharding events (%d):\n", len(li.Events)))
+	for _, event := range li.Events {
+		repeated := ""
+		if event.Count > 1 {
+			repeated = fmt.Sprintf(" (x%d until %v)", event.Count, event.Last.UTC().Format(time.RFC3339))
+		}
+		buffer.WriteString(fmt.Sprintf("%v %-20s %-10s %v%v\n", event.Time.UTC().Format(time.RFC3339), event.Host,
+			event.Type, event.Message, repeated))
+	}
+	return buffer.String()
+}
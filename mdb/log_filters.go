@@ -0,0 +1,123 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+var errFiltered = errors.New("filtered")
+
+var filterTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.000-0700", "2006-01-02T15:04:05",
+	"2006-01-02T15:04", "2006-01-02"}
+
+// SetTimeRange sets to parse only lines logged in [since, until), either can be empty,
+// timestamps without a time zone are in UTC
+func (li *LogInfo) SetTimeRange(since string, until string) error {
+	var err error
+	if since != "" {
+		if li.since, err = parseFilterTime(since); err != nil {
+			return err
+		}
+		li.addParam("--since", since)
+	}
+	if until != "" {
+		if li.until, err = parseFilterTime(until); err != nil {
+			return err
+		}
+		li.addParam("--until", until)
+	}
+	if li.since.IsZero() == false && li.until.IsZero() == false && li.until.After(li.since) == false {
+		return fmt.Errorf("until %v is not after since %v", until, since)
+	}
+	return nil
+}
+
+// SetNamespaces sets comma separated namespace globs to include, or to exclude if prefixed with !,
+// for example orders.*,!*.sessions
+func (li *LogInfo) SetNamespaces(namespaces string) error {
+	li.nsIncludes = []string{}
+	li.nsExcludes = []string{}
+	for _, pattern := range strings.Split(namespaces, ",") {
+		pattern = strings.TrimSpace(pattern)
+		exclude := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid namespace pattern %v: %v", pattern, err)
+		}
+		if exclude {
+			li.nsExcludes = append(li.nsExcludes, pattern)
+		} else {
+			li.nsIncludes = append(li.nsIncludes, pattern)
+		}
+	}
+	if len(li.nsIncludes) > 0 || len(li.nsExcludes) > 0 {
+		li.addParam("--ns", namespaces)
+	}
+	return nil
+}
+
+// addParam records a filter in keyhole info params
+func (li *LogInfo) addParam(name string, value string) {
+	if li.KeyholeInfo != nil {
+		li.KeyholeInfo.Params += fmt.Sprintf(" %v %v", name, value)
+	}
+}
+
+// isTimeFiltered returns true if a line is logged out of the time range
+func (li *LogInfo) isTimeFiltered(logType string, str string) bool {
+	if li.since.IsZero() && li.until.IsZero() {
+		return false
+	}
+	var t time.Time
+	if logType == logTypeLogv2 {
+		const prefix = `"$date":"`
+		if i := strings.Index(str, prefix); i >= 0 {
+			s := str[i+len(prefix):]
+			if j := strings.IndexByte(s, '"'); j > 0 {
+				t = getLogTime(s[:j])
+			}
+		}
+	} else {
+		t = getLogTime(str)
+	}
+	if t.IsZero() {
+		return false
+	}
+	return (li.since.IsZero() == false && t.Before(li.since)) || (li.until.IsZero() == false && t.Before(li.until) == false)
+}
+
+// isNamespaceIncluded returns true if a namespace matches an include glob, if any, and no exclude globs
+func (li *LogInfo) isNamespaceIncluded(ns string) bool {
+	for _, pattern := range li.nsExcludes {
+		if matched, _ := path.Match(pattern, ns); matched {
+			return false
+		}
+	}
+	if len(li.nsIncludes) == 0 {
+		return true
+	}
+	for _, pattern := range li.nsIncludes {
+		if matched, _ := path.Match(pattern, ns); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFilterTime parses a timestamp of layouts in filterTimeLayouts
+func parseFilterTime(str string) (time.Time, error) {
+	for _, layout := range filterTimeLayouts {
+		if t, err := time.Parse(layout, str); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %v, use RFC3339, for example 2020-05-12T12:00:00Z", str)
+}
@@ -0,0 +1,45 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestLogInfoFilters(t *testing.T) {
+	lines := []string{
+		`2020-05-12T12:48:14.398-0400 I COMMAND [conn1] command orders.items command: find { find: "items", filter: { sku: "A" }, $db: "orders" } planSummary: COLLSCAN keysExamined:0 docsExamined:100 numYields:0 nreturned:1 reslen:100 protocol:op_msg 120ms`,
+		`2020-05-12T12:58:14.398-0400 I COMMAND [conn1] command orders.items command: find { find: "items", filter: { sku: "A", qty: 1 }, $db: "orders" } planSummary: COLLSCAN keysExamined:0 docsExamined:100 numYields:0 nreturned:1 reslen:100 protocol:op_msg 120ms`,
+		`2020-05-12T12:58:15.398-0400 I COMMAND [conn1] command orders.sessions command: find { find: "sessions", filter: { user: "A" }, $db: "orders" } planSummary: COLLSCAN keysExamined:0 docsExamined:100 numYields:0 nreturned:1 reslen:100 protocol:op_msg 120ms`,
+		`{"t":{"$date":"2020-05-12T16:59:00.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"Blue"},"$db":"keyhole"},"planSummary":"COLLSCAN","durationMillis":820}}`,
+	}
+	loginfo := NewLogInfo()
+	loginfo.SetKeyholeInfo(NewKeyholeInfo("test", "-loginfo"))
+	loginfo.SetSilent(true)
+	if err := loginfo.SetTimeRange("2020-05-12T16:50:00Z", "2020-05-12T17:00"); err != nil {
+		t.Fatal(err)
+	}
+	if err := loginfo.SetNamespaces("orders.*,!*.sessions"); err != nil {
+		t.Fatal(err)
+	}
+	if err := loginfo.Parse(bufio.NewReader(strings.NewReader(strings.Join(lines[:3], "\n")))); err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.OpsPatterns) != 1 || loginfo.OpsPatterns[0].Filter != "{qty:1, sku:1}" {
+		t.Fatal("unexpected ops patterns", loginfo.OpsPatterns)
+	}
+	if strings.Contains(loginfo.KeyholeInfo.Params, "--ns orders.*,!*.sessions") == false {
+		t.Fatal("expected filters in params, but got", loginfo.KeyholeInfo.Params)
+	}
+	if loginfo.isTimeFiltered(logTypeLogv2, lines[3]) || loginfo.isNamespaceIncluded("keyhole.cars") {
+		t.Fatal("expected logv2 line in time range and namespace excluded")
+	}
+	if err := loginfo.SetTimeRange("2020-05-12", "2020-05-11"); err == nil {
+		t.Fatal("expected error of until before since")
+	}
+	if err := loginfo.SetNamespaces("orders.[a"); err == nil {
+		t.Fatal("expected error of bad pattern")
+	}
+}
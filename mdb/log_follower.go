@@ -0,0 +1,176 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const clearScreen = "\x1b[H\x1b[2J"
+
+// logTail reads appended lines from a growing log file and reopens it after rotation
+type logTail struct {
+	file     *os.File
+	filename string
+	offset   int64
+	partial  string
+	reader   *bufio.Reader
+}
+
+// open opens the log file, seeks to the end if atEnd is true
+func (t *logTail) open(atEnd bool) error {
+	var err error
+	if t.file, err = os.Open(t.filename); err != nil {
+		return err
+	}
+	t.offset = 0
+	if atEnd {
+		if t.offset, err = t.file.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+	t.partial = ""
+	t.reader = bufio.NewReader(t.file)
+	return nil
+}
+
+// readLines returns complete lines appended since last read
+func (t *logTail) readLines() []string {
+	var lines []string
+	for {
+		str, err := t.reader.ReadString('\n')
+		t.offset += int64(len(str))
+		if err != nil { // incomplete line, wait for the rest
+			t.partial += str
+			return lines
+		}
+		str = strings.TrimRight(t.partial+str, "\r\n")
+		t.partial = ""
+		if str != "" {
+			lines = append(lines, str)
+		}
+	}
+}
+
+// isRotated returns true if the log file was renamed, replaced or truncated
+func (t *logTail) isRotated() bool {
+	var err error
+	var curr, prev os.FileInfo
+	if curr, err = os.Stat(t.filename); err != nil { // renamed, new file not created yet
+		return false
+	}
+	if prev, err = t.file.Stat(); err != nil {
+		return true
+	}
+	return os.SameFile(curr, prev) == false || curr.Size() < t.offset
+}
+
+// followBucket holds query patterns and slow ops of an interval
+type followBucket struct {
+	opsMap  map[string]OpPerformanceDoc
+	slowOps []SlowOps
+}
+
+// Follow tails a live log file and prints query patterns and slow ops of a rolling window every interval.
+// Time and namespace filters and clients of connections apply as of Parse, events, issues, plan flips,
+// timeline, and transactions are not reported in follow mode.
+func (li *LogInfo) Follow(filename string, interval time.Duration, window time.Duration) error {
+	var err error
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	if window < interval {
+		window = interval
+	}
+	tail := &logTail{filename: filename}
+	if err = tail.open(true); err != nil {
+		return err
+	}
+	defer func() { tail.file.Close() }()
+	li.filename = filename
+	li.resetStats()
+	numBuckets := int((window + interval - 1) / interval)
+	buckets := []followBucket{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		lines := tail.readLines()
+		if tail.isRotated() {
+			lines = append(lines, tail.readLines()...) // drain the rotated file
+			tail.file.Close()
+			if err = tail.open(false); err != nil {
+				return err
+			}
+			if li.verbose {
+				fmt.Println("reopened rotated log", filename)
+			}
+			lines = append(lines, tail.readLines()...)
+		}
+		buckets = li.addFollowBucket(buckets, lines, numBuckets)
+		if li.silent == false {
+			fmt.Print(clearScreen)
+		}
+		fmt.Printf("%v %v, last %v, refreshed every %v\n", time.Now().Format(time.RFC3339), filename, window, interval)
+		fmt.Println(li.printLogsSummary())
+	}
+	return err
+}
+
+// addFollowBucket parses lines into a new bucket, drops buckets out of the window of numBuckets, and
+// sets query patterns and slow ops of the window
+func (li *LogInfo) addFollowBucket(buckets []followBucket, lines []string, numBuckets int) []followBucket {
+	// plans, timeline, and transactions are not followed, clients of connections are kept
+	li.plansMap = map[string]*PlanFlipsDoc{}
+	li.timelineMap = map[string]TimelineDoc{}
+	li.txnNamespaces = map[string][]string{}
+	li.SlowOps = []SlowOps{}
+	bucket := followBucket{opsMap: map[string]OpPerformanceDoc{}}
+	li.followLines(bucket.opsMap, lines)
+	bucket.slowOps = li.SlowOps
+	buckets = append(buckets, bucket)
+	if len(buckets) > numBuckets {
+		buckets = buckets[len(buckets)-numBuckets:]
+	}
+	opsMap := map[string]OpPerformanceDoc{}
+	slowOps := []SlowOps{}
+	for _, b := range buckets {
+		for key, doc := range b.opsMap {
+			if value, ok := opsMap[key]; ok {
+				opsMap[key] = mergeOpPerformanceDoc(value, doc)
+			} else {
+				opsMap[key] = doc
+			}
+		}
+		slowOps = append(slowOps, b.slowOps...)
+	}
+	sort.SliceStable(slowOps, func(i, j int) bool { return slowOps[i].Milli > slowOps[j].Milli })
+	if len(slowOps) > topN {
+		slowOps = slowOps[:topN]
+	}
+	li.SlowOps = slowOps
+	li.setOpsPatterns(opsMap)
+	return buckets
+}
+
+// followLines parses lines of either text or logv2 format into the ops map of a bucket
+func (li *LogInfo) followLines(opsMap map[string]OpPerformanceDoc, lines []string) {
+	for _, str := range lines {
+		logType := getLogType(str)
+		if logType == "" {
+			continue
+		}
+		result := li.parseLine(logType, str)
+		if result.client != nil {
+			li.setConnClient(*result.client)
+		}
+		if result.err == nil {
+			li.addStat(opsMap, result.stat, str)
+		}
+	}
+}
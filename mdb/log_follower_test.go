@@ -0,0 +1,122 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func appendLog(t *testing.T, filename string, str string) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err = file.WriteString(str); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogTailRotated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyhole")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "mongod.log")
+	appendLog(t, filename, "line 1\n")
+	tail := &logTail{filename: filename}
+	if err = tail.open(true); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { tail.file.Close() }()
+	appendLog(t, filename, "line 2\nline")
+	if lines := tail.readLines(); len(lines) != 1 || lines[0] != "line 2" {
+		t.Fatal("expected line 2 only, but got", lines)
+	}
+	appendLog(t, filename, " 3\n")
+	if lines := tail.readLines(); len(lines) != 1 || lines[0] != "line 3" {
+		t.Fatal("expected the partial line 3, but got", lines)
+	}
+	if tail.isRotated() == true {
+		t.Fatal("expected not rotated")
+	}
+
+	// logRotate renames the file, then mongod creates a new one
+	appendLog(t, filename, "line 4\n")
+	if err = os.Rename(filename, filename+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if tail.isRotated() == true {
+		t.Fatal("expected not rotated before a new file is created")
+	}
+	appendLog(t, filename, "line 5\n")
+	if tail.isRotated() == false {
+		t.Fatal("expected rotated after renamed")
+	}
+	if lines := tail.readLines(); len(lines) != 1 || lines[0] != "line 4" {
+		t.Fatal("expected line 4 drained from the rotated file, but got", lines)
+	}
+	tail.file.Close()
+	if err = tail.open(false); err != nil {
+		t.Fatal(err)
+	}
+	if lines := tail.readLines(); len(lines) != 1 || lines[0] != "line 5" {
+		t.Fatal("expected line 5 of the new file, but got", lines)
+	}
+
+	// copytruncate truncates the file in place
+	if err = os.Truncate(filename, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendLog(t, filename, "6\n")
+	if tail.isRotated() == false {
+		t.Fatal("expected rotated after truncated")
+	}
+	tail.file.Close()
+	if err = tail.open(false); err != nil {
+		t.Fatal(err)
+	}
+	if lines := tail.readLines(); len(lines) != 1 || lines[0] != "6" {
+		t.Fatal("expected 6 of the truncated file, but got", lines)
+	}
+}
+
+func TestAddFollowBucket(t *testing.T) {
+	lines := [][]string{
+		{
+			`{"t":{"$date":"2020-05-12T16:59:00.000+00:00"},"s":"I","c":"NETWORK","id":51800,"ctx":"conn12","msg":"client metadata","attr":{"remote":"10.0.0.5:53824","client":"conn12","doc":{"driver":{"name":"nodejs","version":"3.6.0"},"application":{"name":"orders"}}}}`,
+			`{"t":{"$date":"2020-05-12T16:59:01.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"Blue"},"$db":"keyhole"},"planSummary":"COLLSCAN","durationMillis":820}}`,
+		},
+		{
+			`{"t":{"$date":"2020-05-12T16:59:10.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.dealers","command":{"find":"dealers","filter":{"city":"Atlanta"},"$db":"keyhole"},"planSummary":"COLLSCAN","durationMillis":120}}`,
+			`{"t":{"$date":"2020-05-11T16:59:10.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"Red"},"$db":"keyhole"},"planSummary":"COLLSCAN","durationMillis":5000}}`,
+			`{"t":{"$date":"2020-05-12T16:59:11.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"Red"},"$db":"keyhole"},"planSummary":"COLLSCAN","durationMillis":320}}`,
+		},
+		{},
+	}
+	li := NewLogInfo()
+	li.SetSilent(true)
+	li.SetNamespaces("keyhole.cars")
+	li.SetTimeRange("2020-05-12", "2020-05-13")
+	buckets := []followBucket{}
+	for _, bucket := range lines[:2] {
+		buckets = li.addFollowBucket(buckets, bucket, 2)
+	}
+	if len(li.OpsPatterns) != 1 || li.OpsPatterns[0].Count != 2 || len(li.SlowOps) != 2 {
+		t.Fatal("expected both cars finds in the window, but got", li.OpsPatterns, li.SlowOps)
+	}
+	buckets = li.addFollowBucket(buckets, lines[2], 2)
+	if len(buckets) != 2 || len(li.OpsPatterns) != 1 || li.OpsPatterns[0].Count != 1 || li.OpsPatterns[0].MaxMilli != 320 {
+		t.Fatal("expected the first bucket out of the window, but got", li.OpsPatterns)
+	}
+	if len(li.SlowOps) != 1 || li.SlowOps[0].Milli != 320 {
+		t.Fatal("expected slow ops of the window only, but got", li.SlowOps)
+	}
+	if apps := li.OpsPatterns[0].Apps; len(apps) != 1 || apps[0].App != "orders" {
+		t.Fatal("expected the app of a connection of an earlier bucket, but got", apps)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// HostPerformanceDoc stores performance data of a query pattern from a host
+type HostPerformanceDoc struct {
+	Count      int    `json:"count" bson:"count"`           // number of ops
+	Host       string `json:"host" bson:"host"`             // host:port or log file name
+	MaxMilli   int    `json:"maxmilli" bson:"maxmilli"`     // max millisecond
+	TotalMilli int    `json:"totalmilli" bson:"totalmilli"` // total milliseconds
+}
+
+// addHost adds an op to the breakdown of its host
+func (doc *OpPerformanceDoc) addHost(host string, milli int) {
+	for i, h := range doc.Hosts {
+		if h.Host == host {
+			doc.Hosts[i].Count++
+			doc.Hosts[i].TotalMilli += milli
+			if milli > h.MaxMilli {
+				doc.Hosts[i].MaxMilli = milli
+			}
+			return
+		}
+	}
+	doc.Hosts = append(doc.Hosts, HostPerformanceDoc{Count: 1, Host: host, MaxMilli: milli, TotalMilli: milli})
+}
+
+// mergeHosts merges host breakdowns of the same query pattern
+func mergeHosts(a []HostPerformanceDoc, b []HostPerformanceDoc) []HostPerformanceDoc {
+	hosts := append([]HostPerformanceDoc{}, a...)
+	for _, h := range b {
+		found := false
+		for i := range hosts {
+			if hosts[i].Host == h.Host {
+				hosts[i].Count += h.Count
+				hosts[i].TotalMilli += h.TotalMilli
+				if h.MaxMilli > hosts[i].MaxMilli {
+					hosts[i].MaxMilli = h.MaxMilli
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// renameHost replaces a host named after a log file with the host found in the log
+func renameHost(opsMap map[string]OpPerformanceDoc, slowOps []SlowOps, events []LogEvent, from string, to string) {
+	for key, doc := range opsMap {
+		for i, h := range doc.Hosts {
+			if h.Host == from {
+				doc.Hosts[i].Host = to
+			}
+		}
+		doc.Hosts = mergeHosts(nil, doc.Hosts) // same host from multiple rotated files
+		opsMap[key] = doc
+	}
+	for i := range slowOps {
+		if slowOps[i].Host == from {
+			slowOps[i].Host = to
+		}
+	}
+	for i := range events {
+		if events[i].Host == from {
+			events[i].Host = to
+		}
+	}
+}
+
+// resolveHostAliases returns the final host of each alias of chained aliases, for example a to c of
+// a to b and b to c, hosts of a cycle are kept
+func resolveHostAliases(aliases map[string]string) map[string]string {
+	resolved := map[string]string{}
+	for from, to := range aliases {
+		seen := map[string]bool{from: true}
+		for next, ok := aliases[to]; ok && seen[to] == false; next, ok = aliases[to] {
+			seen[to] = true
+			to = next
+		}
+		if to != from {
+			resolved[from] = to
+		}
+	}
+	return resolved
+}
+
+var rotatedSuffix = regexp.MustCompile(`(\.log)?(\.\d+|\.\d{4}-\d{2}-\d{2}T\d{2}-\d{2}-\d{2}(\.\d+)?)?(\.gz)?$`)
+
+// getHostFromFilename returns a host name from a log file name, for example
+// shard01a.log.2020-05-12T00-00-00.gz or shard01a/mongod.log
+func getHostFromFilename(filename string) string {
+	base := rotatedSuffix.ReplaceAllString(filepath.Base(filename), "")
+	if base == "mongod" || base == "mongos" || base == "" {
+		if dir := filepath.Base(filepath.Dir(filename)); dir != "." && dir != string(filepath.Separator) {
+			return dir
+		}
+	}
+	return base
+}
+
+var textHostRegex = regexp.MustCompile(`MongoDB starting : pid=\d+ port=(\d+) .*host=(\S+)`)
+
+// getHostFromLog returns host:port from a "MongoDB starting" log line of text or logv2 format
+func getHostFromLog(str string) string {
+	if strings.HasPrefix(str, "{") {
+		var doc struct {
+			Attr struct {
+				Host string      `json:"host"`
+				Port interface{} `json:"port"`
+			} `json:"attr"`
+		}
+		if err := json.Unmarshal([]byte(str), &doc); err != nil || doc.Attr.Host == "" {
+			return ""
+		}
+		return fmt.Sprintf("%v:%v", doc.Attr.Host, doc.Attr.Port)
+	}
+	if result := textHostRegex.FindStringSubmatch(str); len(result) == 3 {
+		return result[2] + ":" + result[1]
+	}
+	return ""
+}
+
+// getNumberHosts returns number of hosts in ops patterns
+func getNumberHosts(opsPatterns []OpPerformanceDoc) int {
+	hosts := map[string]bool{}
+	for _, doc := range opsPatterns {
+		for _, h := range doc.Hosts {
+			hosts[h.Host] = true
+		}
+	}
+	return len(hosts)
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetHostFromFilename(t *testing.T) {
+	tests := map[string]string{
+		"shard01a.log": "shard01a",
+		"logs/shard01a.log.2020-05-12T00-00-00.gz": "shard01a",
+		"bundle/shard02b/mongod.log.1":             "shard02b",
+		"bundle/shard02c/mongod.log":               "shard02c",
+	}
+	for filename, expected := range tests {
+		if host := getHostFromFilename(filename); host != expected {
+			t.Fatal("expected", expected, "but got", host, "from", filename)
+		}
+	}
+}
+
+func TestGetHostFromLog(t *testing.T) {
+	str := `2020-05-12T12:40:01.000-0400 I  CONTROL  [initandlisten] MongoDB starting : pid=1234 port=27017 dbpath=/data/db 64-bit host=shard01a`
+	if host := getHostFromLog(str); host != "shard01a:27017" {
+		t.Fatal("expected shard01a:27017, but got", host)
+	}
+	str = `{"t":{"$date":"2020-08-01T10:00:00.000+00:00"},"s":"I","c":"CONTROL","id":4615611,"ctx":"initandlisten","msg":"MongoDB starting","attr":{"pid":111,"port":27018,"dbPath":"/data/db","architecture":"64-bit","host":"shard02b"}}`
+	if host := getHostFromLog(str); host != "shard02b:27018" {
+		t.Fatal("expected shard02b:27018, but got", host)
+	}
+}
+
+func TestLogInfoRotatedHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyhole")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	starting := `{"t":{"$date":"2020-08-01T09:00:00.000+00:00"},"s":"I","c":"CONTROL","id":4615611,"ctx":"initandlisten","msg":"MongoDB starting","attr":{"pid":111,"port":27017,"dbPath":"/data/db","architecture":"64-bit","host":"shard01a"}}`
+	os.MkdirAll(filepath.Join(dir, "shard01a"), 0755)
+	rotated := filepath.Join(dir, "shard01a", "mongod.log.1") // rotated, no startup line
+	current := filepath.Join(dir, "shard01a", "mongod.log")
+	ioutil.WriteFile(rotated, []byte(archivedLog+"\n"), 0644)
+	ioutil.WriteFile(current, []byte(starting+"\n"+archivedLog+"\n"), 0644)
+	loginfo := NewLogInfo()
+	loginfo.SetSilent(true)
+	if _, err = loginfo.AnalyzeFiles([]string{current, rotated}, false); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(loginfo.OutputFilename)
+	if len(loginfo.OpsPatterns) != 1 || len(loginfo.OpsPatterns[0].Hosts) != 1 ||
+		loginfo.OpsPatterns[0].Hosts[0].Host != "shard01a:27017" || loginfo.OpsPatterns[0].Hosts[0].Count != 2 {
+		t.Fatal("expected one host shard01a:27017 of 2 ops, but got", loginfo.OpsPatterns)
+	}
+}
+
+func TestRenameHostsChained(t *testing.T) {
+	aliases := resolveHostAliases(map[string]string{"a": "b", "b": "c", "x": "y", "y": "x"})
+	if len(aliases) != 2 || aliases["a"] != "c" || aliases["b"] != "c" {
+		t.Fatal("expected a and b to c, but got", aliases)
+	}
+	for n := 0; n < 10; n++ { // map order differs of runs
+		loginfo := NewLogInfo()
+		loginfo.hostAliases = map[string]string{"a": "b", "b": "c"}
+		opsMap := map[string]OpPerformanceDoc{"find": {Hosts: []HostPerformanceDoc{
+			{Host: "a", Count: 1, TotalMilli: 100}, {Host: "b", Count: 2, TotalMilli: 200}}}}
+		loginfo.SlowOps = []SlowOps{{Host: "a", Milli: 100}}
+		loginfo.renameHosts(opsMap)
+		if hosts := opsMap["find"].Hosts; len(hosts) != 1 || hosts[0].Host != "c" || hosts[0].Count != 3 ||
+			loginfo.SlowOps[0].Host != "c" {
+			t.Fatal("expected ops of a and b under c, but got", hosts, loginfo.SlowOps)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IssueDoc stores counts of warning, error, or fatal messages of a kind
+type IssueDoc struct {
+	Component string    `json:"component" bson:"component"` // NETWORK, STORAGE, etc
+	Count     int       `json:"count" bson:"count"`         // number of lines
+	First     time.Time `json:"first" bson:"first"`         // time first seen
+	ID        int       `json:"id" bson:"id"`               // logv2 id, 0 for text logs
+	Last      time.Time `json:"last" bson:"last"`           // time last seen
+	Message   string    `json:"message" bson:"message"`     // logv2 msg or normalized text message
+	Sample    string    `json:"sample" bson:"sample"`       // first line seen
+	Severity  string    `json:"severity" bson:"severity"`   // W, E, or F
+}
+
+const maxIssueMessage = 160
+const maxIssueSample = 512
+
+var issueSeverities = map[string]int{"F": 0, "E": 1, "W": 2}
+
+// issueNormalizers replace variable values of text messages, in the order listed
+var issueNormalizers = []struct {
+	regex *regexp.Regexp
+	repl  string
+}{
+	{regexp.MustCompile(`"[^"]*"`), `"..."`},
+	{regexp.MustCompile(`'[^']*'`), `'...'`},
+	{regexp.MustCompile(`\b[\w.-]+:\d{2,5}\b`), `<host>`},
+	{regexp.MustCompile(`\b0x[0-9a-fA-F]+\b`), `0x...`},
+	{regexp.MustCompile(`\b[0-9a-fA-F]{24}\b`), `<id>`},
+	{regexp.MustCompile(`\d+(\.\d+)?`), `N`},
+}
+
+// getLogIssue returns a warning, error, or fatal message of a line, or nil
+func getLogIssue(line logLine, str string) *IssueDoc {
+	if _, ok := issueSeverities[line.severity]; !ok {
+		return nil
+	}
+	message := line.message
+	if line.id == 0 {
+		message = normalizeIssueMessage(message)
+	}
+	if len(str) > maxIssueSample {
+		str = str[:maxIssueSample-3] + "..."
+	}
+	return &IssueDoc{Component: line.component, Count: 1, First: line.time, ID: line.id, Last: line.time,
+		Message: message, Sample: str, Severity: line.severity}
+}
+
+// normalizeIssueMessage replaces values in a text message, for example
+// SocketException: too many open files 10.0.0.9:27017 to SocketException: too many open files <host>
+func normalizeIssueMessage(message string) string {
+	for _, n := range issueNormalizers {
+		message = n.regex.ReplaceAllString(message, n.repl)
+	}
+	if len(message) > maxIssueMessage {
+		message = message[:maxIssueMessage-3] + "..."
+	}
+	return message
+}
+
+// addIssue counts an issue by severity, component, and logv2 id or normalized message
+func (li *LogInfo) addIssue(issue IssueDoc) {
+	if li.issuesMap == nil {
+		li.issuesMap = map[string]IssueDoc{}
+	}
+	key := fmt.Sprintf("%v %v %v", issue.Severity, issue.Component, issue.ID)
+	if issue.ID == 0 {
+		key += " " + issue.Message
+	}
+	doc, ok := li.issuesMap[key]
+	if !ok {
+		li.issuesMap[key] = issue
+		return
+	}
+	doc.Count++
+	if issue.First.Before(doc.First) {
+		doc.First = issue.First
+	}
+	if issue.Last.After(doc.Last) {
+		doc.Last = issue.Last
+	}
+	li.issuesMap[key] = doc
+}
+
+// setIssues sets issues from the issues map, sorted by severity and count
+func (li *LogInfo) setIssues() {
+	li.Issues = make([]IssueDoc, 0, len(li.issuesMap))
+	for _, doc := range li.issuesMap {
+		li.Issues = append(li.Issues, doc)
+	}
+	sort.Slice(li.Issues, func(i, j int) bool {
+		if li.Issues[i].Severity != li.Issues[j].Severity {
+			return issueSeverities[li.Issues[i].Severity] < issueSeverities[li.Issues[j].Severity]
+		}
+		if li.Issues[i].Count != li.Issues[j].Count {
+			return li.Issues[i].Count > li.Issues[j].Count
+		}
+		return li.Issues[i].Message < li.Issues[j].Message
+	})
+}
+
+// printIssues prints top warnings, errors, and fatal messages
+func (li *LogInfo) printIssues() string {
+	if len(li.Issues) == 0 {
+		return ""
+	}
+	total := 0
+	for _, doc := range li.Issues {
+		total += doc.Count
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Warnings and errors, %d lines of %d kinds", total, len(li.Issues)))
+	if len(li.Issues) > topN {
+		buffer.WriteString(fmt.Sprintf(" (list top %d)", topN))
+	}
+	buffer.WriteString(":\n")
+	for i, doc := range li.Issues {
+		if i == topN {
+			break
+		}
+		id := ""
+		if doc.ID > 0 {
+			id = fmt.Sprintf("id:%d ", doc.ID)
+		}
+		buffer.WriteString(fmt.Sprintf("%v %-10s %8d  %v - %v  %v%v\n", doc.Severity, doc.Component, doc.Count,
+			doc.First.UTC().Format(time.RFC3339), doc.Last.UTC().Format(time.RFC3339), id,
+			strings.ReplaceAll(doc.Message, "\n", " ")))
+	}
+	return buffer.String()
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// logLine holds common fields of a text or logv2 line
+type logLine struct {
+	attr      string                 // logv2 attr in JSON
+	attrs     map[string]interface{} // logv2 attr
+	component string
+	context   string
+	id        int // logv2 id
+	message   string
+	severity  string // D, I, W, E, or F
+	time      time.Time
+}
+
+// logv2Line holds common fields of a logv2 line
+type logv2Line struct {
+	Attr      map[string]interface{} `json:"attr"`
+	Component string                 `json:"c"`
+	Context   string                 `json:"ctx"`
+	ID        int                    `json:"id"`
+	Message   string                 `json:"msg"`
+	Severity  string                 `json:"s"`
+	T         struct {
+		Date string `json:"$date"`
+	} `json:"t"`
+}
+
+var logv2Filters = []string{`"s":"W"`, `"s":"E"`, `"s":"F"`, `"c":"REPL`, `"c":"ELECTION"`, `"c":"ROLLBACK"`, `"c":"SHARDING"`, `"c":"TXN"`,
+	`"c":"NETWORK"`}
+
+// getLogLine returns common fields of a line, logv2 lines are decoded only if they
+// are warnings, errors, events, transactions, or connections
+func getLogLine(logType string, str string) (logLine, bool) {
+	if logType == logTypeText {
+		return getTextLogLine(str)
+	}
+	found := false
+	for _, filter := range logv2Filters {
+		if strings.Contains(str, filter) {
+			found = true
+			break
+		}
+	}
+	var line logLine
+	var doc logv2Line
+	if found == false || json.Unmarshal([]byte(str), &doc) != nil {
+		return line, false
+	}
+	line = logLine{attrs: doc.Attr, component: doc.Component, context: doc.Context, id: doc.ID, message: doc.Message,
+		severity: doc.Severity, time: getLogTime(doc.T.Date)}
+	if len(line.severity) > 1 { // D1 to D5
+		line.severity = line.severity[:1]
+	}
+	if len(doc.Attr) > 0 {
+		if buf, err := json.Marshal(doc.Attr); err == nil {
+			line.attr = string(buf)
+		}
+	}
+	return line, true
+}
+
+// getTextLogLine returns common fields of a text line of warnings, errors, events, or connections, for example
+// 2020-05-12T12:51:00.000-0400 I  REPL     [replexec-5] transition to PRIMARY from SECONDARY
+func getTextLogLine(str string) (logLine, bool) {
+	var line logLine
+	rest := str
+	next := func() string {
+		rest = strings.TrimLeft(rest, " ")
+		i := strings.IndexByte(rest, ' ')
+		if i < 0 {
+			i = len(rest)
+		}
+		field := rest[:i]
+		rest = rest[i:]
+		return field
+	}
+	ts, severity, component := next(), next(), next()
+	if severity == "" || strings.IndexByte("DIWEF", severity[0]) < 0 {
+		return line, false
+	} else if _, ok := issueSeverities[severity[:1]]; !ok && eventComponents[component] == false && component != "NETWORK" {
+		return line, false // neither warnings, errors, events, nor connections
+	}
+	rest = strings.TrimLeft(rest, " ")
+	i := strings.IndexByte(rest, ']')
+	if strings.HasPrefix(rest, "[") == false || i < 0 {
+		return line, false
+	}
+	line = logLine{component: component, context: rest[1:i], message: strings.TrimLeft(rest[i+1:], " "),
+		severity: severity[:1], time: getLogTime(ts)}
+	return line, true
+}
@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/simagix/gox"
 )
@@ -15,10 +16,12 @@ import (
 func (li *LogInfo) ParseLog(str string) (LogStats, error) {
 	var err error
 	var stat LogStats
-	matched := regexp.MustCompile(li.regex)
+	matched := li.logRegex
+	if matched == nil {
+		matched = regexp.MustCompile(li.regex)
+	}
 
 	scan := ""
-	aggStages := ""
 	if matched.MatchString(str) == true {
 		if strings.Index(str, "COLLSCAN") >= 0 {
 			scan = COLLSCAN
@@ -48,7 +51,6 @@ func (li *LogInfo) ParseLog(str string) (LogStats, error) {
 			}
 		}
 
-		re := regexp.MustCompile(`^(\w+) ({.*})$`)
 		op := result[2]
 		ns := result[3]
 		if strings.HasPrefix(ns, "admin.") || strings.HasPrefix(ns, "config.") || strings.HasPrefix(ns, "local.") {
@@ -60,110 +62,35 @@ func (li *LogInfo) ParseLog(str string) (LogStats, error) {
 		}
 		filter := result[4][:epos]
 		ms := result[5]
+		var cmd, orig logDoc
 		if op == "command" {
 			idx := strings.Index(filter, "command: ")
 			if idx > 0 {
 				filter = filter[idx+len("command: "):]
 			}
-			res := re.FindStringSubmatch(filter)
+			res := commandRegex.FindStringSubmatch(filter)
 			if len(res) < 3 {
 				return stat, err
 			}
 			op = res[1]
-			filter = res[2]
+			cmd, _ = parseLogDoc(res[2]).(logDoc)
+		} else if i := strings.Index(filter, "{"); i >= 0 { // a statement { q: ..., u: ... } or a query
+			doc, _ := parseLogDoc(filter[i:]).(logDoc)
+			if _, ok := doc.get("q").(logDoc); ok {
+				cmd = doc
+			} else {
+				cmd = logDoc{{key: "query", value: doc}}
+			}
 		}
-
-		if op == "insert" {
-			filter = "{ }"
-		} else if hasFilter(op) == false {
-			return stat, err
+		if op == "getmore" {
+			op = cmdGetMore
+		}
+		if op == cmdGetMore {
+			orig, _ = getLogValue(result[4], "originatingCommand: ").(logDoc)
 		}
-		if op == "delete" && strings.Index(filter, "writeConcern:") >= 0 {
+		var ok bool
+		if filter, ok = getCommandShape(op, cmd, orig); !ok {
 			return stat, err
-		} else if op == "find" {
-			nstr := "{ }"
-			s := getDocByField(filter, "filter: ")
-			if s != "" {
-				nstr = s
-			}
-			s = getDocByField(filter, "sort: ")
-			if s != "" {
-				aggStages = ", sort: " + s
-			}
-			filter = nstr
-		} else if op == "count" {
-			nstr := ""
-			s := getDocByField(filter, "query: ")
-			if s != "" {
-				nstr = s
-			}
-			filter = nstr
-		} else if op == "distinct" {
-			nstr := ""
-			s := getDocByField(filter, "key: ")
-			if s != "" {
-				nstr = s
-			}
-			if strings.HasSuffix(nstr, " }") {
-				nstr = nstr[:len(nstr)-2]
-			}
-			filter = "{" + nstr + ": 1}"
-		} else if op == "delete" || op == "update" || op == "remove" || op == "findAndModify" {
-			var s string
-			// if result[1] == "WRITE" {
-			if strings.Index(filter, "query: ") >= 0 {
-				s = getDocByField(filter, "query: ")
-			} else {
-				s = getDocByField(filter, "q: ")
-			}
-			if s != "" {
-				filter = s
-			}
-		} else if op == "aggregate" || (op == "getmore" && strings.Index(filter, "pipeline:") > 0) {
-			s := ""
-			for _, mstr := range []string{"pipeline: [ { $match: ", "pipeline: [ { $sort: ", "$facet: "} {
-				s = getDocByField(result[4], mstr)
-				if s != "" {
-					filter = s
-					x := strings.Index(result[4], "$group: ")
-					y := strings.Index(result[4], "$sort: ")
-					if x > 0 && (x < y || y < 0) {
-						aggStages = ", group: " + strings.ReplaceAll(getDocByField(result[4], "$group: "), "1.0", "1")
-					}
-					srt := getDocByField(result[4], "$sort: ")
-					if srt != "" {
-						aggStages += ", sort: " + strings.ReplaceAll(srt, "1.0", "1")
-					}
-					if mstr == "$facet: " {
-						filter = "{ $facet: " + s + " }"
-					}
-					break
-				}
-			}
-			if s == "" {
-				if scan == "COLLSCAN" { // it's a collection scan without $match or $sort
-					filter = "{}"
-				} else {
-					return stat, err
-				}
-			}
-		} else if op == "getMore" || op == "getmore" {
-			s := getDocByField(result[4], "originatingCommand: ")
-			if s != "" {
-				s = getDocByField(s, "filter: ")
-				for _, mstr := range []string{"filter: ", "pipeline: [ { $match: ", "pipeline: [ { $sort: "} {
-					s = getDocByField(result[4], mstr)
-					if s != "" {
-						filter = s
-						break
-					}
-				}
-				if s == "" {
-					return stat, err
-				}
-			} else {
-				return stat, err
-			}
 		}
 		index := getDocByField(str, "planSummary: IXSCAN")
 		if index != "" {
@@ -187,81 +114,78 @@ func (li *LogInfo) ParseLog(str string) (LogStats, error) {
 		} else if strings.Index(str, "exception: shard version not ok") > 0 {
 			return stat, err
 		}
-		filter = removeInElements(filter, "$in: [ ")
-		filter = removeInElements(filter, "$nin: [ ")
-		filter = removeInElements(filter, "$in: [ ")
-		filter = removeInElements(filter, "$nin: [ ")
-
-		isRegex := strings.Index(filter, "{ $regex: ")
-		if isRegex >= 0 {
-			cnt := 0
-			for _, r := range filter[isRegex:] {
-				if r == '}' {
-					break
-				}
-				cnt++
-			}
-			filter = filter[:(isRegex+10)] + "/.../.../" + filter[(isRegex+cnt):]
-		}
-
-		re = regexp.MustCompile(`(: "[^"]*"|: -?\d+(\.\d+)?|: new Date\(\d+?\)|: true|: false)`)
-		filter = re.ReplaceAllString(filter, ":1")
-		re = regexp.MustCompile(`, shardVersion: \[.*\]`)
-		filter = re.ReplaceAllString(filter, "")
-		re = regexp.MustCompile(`( ObjectId\('\S+'\))|(UUID\("\S+"\))|( Timestamp\(\d+, \d+\))|(BinData\(\d+, \S+\))`)
-		filter = re.ReplaceAllString(filter, "1")
-		re = regexp.MustCompile(`(: \/(\^)?\S+\/(\S+)? })`)
-		filter = re.ReplaceAllString(filter, ": /${2}regex/$3}")
-		filter = strings.Replace(strings.Replace(filter, "{ ", "{", -1), " }", "}", -1)
-		filter += aggStages
 		milli, _ := strconv.Atoi(ms)
-		stat = LogStats{filter: filter, index: index, milli: milli, ns: ns, op: op, scan: scan}
+		stat = LogStats{conn: getTextLogContext(str), filter: filter, index: index, milli: milli, ns: ns, op: op, scan: scan,
+			utc: getLogTime(str)}
+		if app, ok := getLogValue(str, " appName: ").(logScalar); ok {
+			stat.app = app.raw
+		}
+		setExaminedStats(&stat, str)
+		stat.waits = getTextWaits(str)
 		return stat, nil
 	}
 	return stat, errors.New("unrecognized log")
 }
 
-func getDocByField(str string, key string) string {
-	ml := gox.NewMongoLog(str)
-	return ml.Get(key)
-}
-
-var filters = []string{"count", "delete", "find", "remove", "update", "aggregate", "getMore", "getmore", "findAndModify", "distinct"}
-
-func hasFilter(op string) bool {
-	for _, f := range filters {
-		if f == op {
-			return true
+var commandRegex = regexp.MustCompile(`^(\w+) ({.*})$`)
+var examinedRegex = regexp.MustCompile(`\b(keysExamined|docsExamined|nreturned|numYields|reslen):(\d+)`)
+var planCacheRegex = regexp.MustCompile(`\b(queryHash|planCacheKey):(\w+)`)
+
+// setExaminedStats sets examined, returned, and plan cache info from a text log line
+func setExaminedStats(stat *LogStats, str string) {
+	for _, result := range examinedRegex.FindAllStringSubmatch(str, -1) {
+		n, _ := strconv.Atoi(result[2])
+		switch result[1] {
+		case "keysExamined":
+			stat.keysExamined = n
+		case "docsExamined":
+			stat.docsExamined = n
+		case "nreturned":
+			stat.nreturned = n
+		case "numYields":
+			stat.numYields = n
+		case "reslen":
+			stat.reslen = n
+		}
+	}
+	for _, result := range planCacheRegex.FindAllStringSubmatch(str, -1) {
+		if result[1] == "queryHash" {
+			stat.queryHash = result[2]
+		} else {
+			stat.planCacheKey = result[2]
 		}
 	}
-	return false
 }
 
-// convert $in: [...] to $in: [ ]
-func removeInElements(str string, instr string) string {
-	idx := strings.Index(str, instr)
-	if idx < 0 {
-		return str
+// getTextLogContext returns the context of a text log line, for example conn12
+func getTextLogContext(str string) string {
+	i := strings.Index(str, " [")
+	if i < 0 {
+		return ""
+	}
+	j := strings.IndexByte(str[i:], ']')
+	if j < 0 {
+		return ""
 	}
+	return str[i+2 : i+j]
+}
 
-	idx += len(instr) - 1
-	cnt, epos := -1, -1
-	for _, r := range str {
-		if cnt < idx {
-			cnt++
-			continue
-		}
-		if r == ']' {
-			epos = cnt
-			break
+var logTimeLayouts = []string{"2006-01-02T15:04:05.000-0700", "2006-01-02T15:04:05.000Z07:00", time.RFC3339Nano}
+
+// getLogTime returns the timestamp at the front of a text log line
+func getLogTime(str string) time.Time {
+	if i := strings.Index(str, " "); i > 0 {
+		str = str[:i]
+	}
+	for _, layout := range logTimeLayouts {
+		if t, err := time.Parse(layout, str); err == nil {
+			return t
 		}
-		cnt++
 	}
+	return time.Time{}
+}
 
-	if epos == -1 {
-		str = str[:idx] + "...]"
-	} else {
-		str = str[:idx] + "..." + str[epos:]
-	}
-	return str
+func getDocByField(str string, key string) string {
+	ml := gox.NewMongoLog(str)
+	return ml.Get(key)
 }
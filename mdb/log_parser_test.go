@@ -11,15 +11,7 @@ func TestParseLog(t *testing.T) {
 	loginfo := NewLogInfo()
 	if stat, err := loginfo.ParseLog(str); err != nil {
 		t.Fatal(err)
-	} else if stat.filter != `{tveUserId:1}, sort: { updated: -1 }` {
+	} else if stat.filter != `{tveUserId:1}, sort: {updated:-1}` {
 		t.Fatal(stat.filter)
 	}
 }
-
-func TestRemoveInElements(t *testing.T) {
-	str := "{ tveUserId: 12541178, titleId: { $in: [ 134734, 3425024 ] } }"
-	filter := removeInElements(str, "$in: [ ")
-	if filter != "{ tveUserId: 12541178, titleId: { $in: [... ] } }" {
-		t.Fatal()
-	}
-}
@@ -0,0 +1,178 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const logBatchSize = 1000
+
+// logBatch holds lines in the order read and their parsed results
+type logBatch struct {
+	lines   []string
+	results []logResult
+	seq     int
+}
+
+// logResult holds a slow op, a connection, an event, an issue, and a transaction parsed from a line
+type logResult struct {
+	client *logClient
+	err    error
+	event  *LogEvent
+	issue  *IssueDoc
+	stat   LogStats
+	txn    *txnStat
+}
+
+// readLine reads a line, including a line longer than the reader buffer
+func readLine(reader *bufio.Reader) (string, error) {
+	buf, isPrefix, err := reader.ReadLine() // 0x0A separator = newline
+	if err != nil {
+		return "", err
+	}
+	str := string(buf)
+	for isPrefix == true {
+		var bbuf []byte
+		if bbuf, isPrefix, err = reader.ReadLine(); err != nil {
+			break
+		}
+		str += string(bbuf)
+	}
+	return str, nil
+}
+
+// parseLine parses a line of text or logv2 format
+func (li *LogInfo) parseLine(logType string, str string) logResult {
+	result := logResult{}
+	if li.isTimeFiltered(logType, str) {
+		result.err = errFiltered
+		return result
+	}
+	if line, ok := getLogLine(logType, str); ok {
+		result.client = getLogClient(line)
+		result.event = getLogEvent(line)
+		result.issue = getLogIssue(line, str)
+		result.txn = getLogTransaction(line)
+	}
+	if logType == logTypeText {
+		result.stat, result.err = li.ParseLog(str)
+	} else {
+		result.stat, result.err = li.ParseLogv2(str)
+	}
+	if result.err == nil && li.isNamespaceIncluded(result.stat.ns) == false {
+		result.err = errFiltered
+	}
+	return result
+}
+
+// addResult adds a parsed line to the ops map, clients, events, issues, and transactions
+func (li *LogInfo) addResult(opsMap map[string]OpPerformanceDoc, result logResult, str string) {
+	if result.client != nil {
+		li.addClient(*result.client)
+	}
+	if result.event != nil {
+		li.addEvent(*result.event)
+	}
+	if result.issue != nil {
+		li.addIssue(*result.issue)
+	}
+	if result.err == nil {
+		li.addStat(opsMap, result.stat, str)
+	}
+	if result.txn != nil {
+		li.addTransaction(*result.txn)
+	}
+}
+
+// readLogLine keeps host info and prints progress of a line read, lines read are printed if progress
+// returns a negative percentage of an unknown size
+func (li *LogInfo) readLogLine(str string, index int, progress func(int) int) {
+	if progress != nil && li.silent == false && index%50 == 0 {
+		if pct := progress(index); pct >= 0 {
+			fmt.Fprintf(os.Stderr, "\r%3d%% ", pct)
+		} else {
+			fmt.Fprintf(os.Stderr, "\r%d lines ", index)
+		}
+	}
+	if li.contentHost == "" && strings.Contains(str, "MongoDB starting") {
+		li.contentHost = getHostFromLog(str)
+	}
+}
+
+// parseSerial parses lines one by one, str is the first line
+func (li *LogInfo) parseSerial(reader *bufio.Reader, opsMap map[string]OpPerformanceDoc, logType string, str string,
+	progress func(int) int) {
+	var err error
+	index := 0
+	for err == nil {
+		li.readLogLine(str, index, progress)
+		index++
+		li.addResult(opsMap, li.parseLine(logType, str), str)
+		str, err = readLine(reader)
+	}
+}
+
+// parseParallel reads lines in batches, parses batches by workers, and merges
+// parsed stats in the order read, str is the first line
+func (li *LogInfo) parseParallel(reader *bufio.Reader, opsMap map[string]OpPerformanceDoc, logType string, str string,
+	progress func(int) int) {
+	batches := make(chan *logBatch, li.workers)
+	results := make(chan *logBatch, li.workers)
+	tokens := make(chan struct{}, 2*li.workers) // limits batches in memory
+	var wg sync.WaitGroup
+	for i := 0; i < li.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				batch.results = make([]logResult, len(batch.lines))
+				for n, line := range batch.lines {
+					batch.results[n] = li.parseLine(logType, line)
+				}
+				results <- batch
+			}
+		}()
+	}
+	go func() {
+		var err error
+		index := 0
+		batch := &logBatch{seq: 0}
+		for err == nil {
+			li.readLogLine(str, index, progress)
+			index++
+			batch.lines = append(batch.lines, str)
+			if len(batch.lines) == logBatchSize {
+				tokens <- struct{}{}
+				batches <- batch
+				batch = &logBatch{seq: batch.seq + 1}
+			}
+			str, err = readLine(reader)
+		}
+		if len(batch.lines) > 0 {
+			tokens <- struct{}{}
+			batches <- batch
+		}
+		close(batches)
+		wg.Wait()
+		close(results)
+	}()
+
+	pending := map[int]*logBatch{}
+	next := 0
+	for batch := range results {
+		pending[batch.seq] = batch
+		for batch, ok := pending[next]; ok; batch, ok = pending[next] {
+			for n, line := range batch.lines {
+				li.addResult(opsMap, batch.results[n], line)
+			}
+			delete(pending, next)
+			next++
+			<-tokens
+		}
+	}
+}
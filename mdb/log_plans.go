@@ -0,0 +1,214 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/simagix/gox"
+)
+
+const maxPlanFlips = 100
+
+// PlanFlipsDoc stores plans of a query shape of a host that ran with more than one plan
+type PlanFlipsDoc struct {
+	Command   string         `json:"command" bson:"command"`     // count, delete, find, remove, and update
+	Filter    string         `json:"filter" bson:"filter"`       // query pattern
+	Flips     []PlanFlipDoc  `json:"flips" bson:"flips"`         // plan changes in chronological order, up to 100
+	Host      string         `json:"host" bson:"host"`           // host:port or log file name
+	Namespace string         `json:"ns" bson:"ns"`               // database.collection
+	NumFlips  int            `json:"numflips" bson:"numflips"`   // number of plan changes
+	Plans     []PlanStatsDoc `json:"plans" bson:"plans"`         // stats of each plan in the order first seen
+	QueryHash string         `json:"queryhash" bson:"queryhash"` // query hash, or shape id of logs without queryHash
+	current   string         // plan of the last op
+}
+
+// PlanFlipDoc stores a plan change of a query shape
+type PlanFlipDoc struct {
+	From string    `json:"from" bson:"from"` // plan summary before
+	Time time.Time `json:"time" bson:"time"` // time of the first op of the new plan
+	To   string    `json:"to" bson:"to"`     // plan summary after
+}
+
+// PlanStatsDoc stores latency of a plan of a query shape
+type PlanStatsDoc struct {
+	Count        int       `json:"count" bson:"count"`               // number of ops
+	First        time.Time `json:"first" bson:"first"`               // time of first op
+	Last         time.Time `json:"last" bson:"last"`                 // time of last op
+	MaxMilli     int       `json:"maxmilli" bson:"maxmilli"`         // max millisecond
+	Plan         string    `json:"plan" bson:"plan"`                 // plan summary, for example IXSCAN { a: 1 }
+	PlanCacheKey string    `json:"plancachekey" bson:"plancachekey"` // plan cache key
+	TotalMilli   int       `json:"totalmilli" bson:"totalmilli"`     // total milliseconds
+}
+
+// getPlanSummary returns the plan summary of an op, or "" if not logged
+func getPlanSummary(stat LogStats) string {
+	if stat.scan == COLLSCAN {
+		return COLLSCAN
+	} else if stat.index == "" {
+		return ""
+	} else if strings.HasPrefix(stat.index, "{") {
+		return "IXSCAN " + strings.ReplaceAll(stat.index, ",\n", ", IXSCAN ")
+	}
+	return stat.index
+}
+
+// addPlan adds the plan of an op to plans of its query shape, ops are keyed by queryHash, or by shape id
+// of logs without queryHash
+func (li *LogInfo) addPlan(stat LogStats, shapeID string) {
+	plan := getPlanSummary(stat)
+	if plan == "" || stat.op == cmdInsert {
+		return
+	}
+	if li.plansMap == nil {
+		li.plansMap = map[string]*PlanFlipsDoc{}
+	}
+	hash := stat.queryHash
+	if hash == "" {
+		hash = shapeID
+	}
+	key := li.host + "/" + hash
+	doc := li.plansMap[key]
+	if doc == nil {
+		doc = &PlanFlipsDoc{Command: stat.op, Filter: stat.filter, Host: li.host, Namespace: stat.ns, QueryHash: hash}
+		li.plansMap[key] = doc
+	}
+	index := -1
+	for i, p := range doc.Plans {
+		if p.Plan == plan {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		doc.Plans = append(doc.Plans, PlanStatsDoc{First: stat.utc, Plan: plan})
+		index = len(doc.Plans) - 1
+	}
+	p := &doc.Plans[index]
+	p.Count++
+	p.Last = stat.utc
+	p.TotalMilli += stat.milli
+	if stat.milli > p.MaxMilli {
+		p.MaxMilli = stat.milli
+	}
+	if stat.planCacheKey != "" {
+		p.PlanCacheKey = stat.planCacheKey
+	}
+	if doc.current != "" && doc.current != plan {
+		doc.addFlip(PlanFlipDoc{From: doc.current, Time: stat.utc, To: plan})
+	}
+	doc.current = plan
+}
+
+// addFlip adds a plan change, up to maxPlanFlips are kept
+func (doc *PlanFlipsDoc) addFlip(flip PlanFlipDoc) {
+	doc.NumFlips++
+	if len(doc.Flips) < maxPlanFlips {
+		doc.Flips = append(doc.Flips, flip)
+	}
+}
+
+// merge merges plans of the same query shape from a later log file of the same host
+func (doc *PlanFlipsDoc) merge(b *PlanFlipsDoc) {
+	for _, bp := range b.Plans {
+		found := false
+		for i := range doc.Plans {
+			p := &doc.Plans[i]
+			if p.Plan != bp.Plan {
+				continue
+			}
+			p.Count += bp.Count
+			p.TotalMilli += bp.TotalMilli
+			if bp.MaxMilli > p.MaxMilli {
+				p.MaxMilli = bp.MaxMilli
+			}
+			if bp.First.Before(p.First) {
+				p.First = bp.First
+			}
+			if bp.Last.After(p.Last) {
+				p.Last = bp.Last
+			}
+			found = true
+			break
+		}
+		if !found {
+			doc.Plans = append(doc.Plans, bp)
+		}
+	}
+	if len(b.Plans) > 0 && doc.current != "" && doc.current != b.Plans[0].Plan {
+		doc.addFlip(PlanFlipDoc{From: doc.current, Time: b.Plans[0].First, To: b.Plans[0].Plan})
+	}
+	for _, flip := range b.Flips {
+		doc.addFlip(flip)
+	}
+	doc.NumFlips += b.NumFlips - len(b.Flips)
+	doc.current = b.current
+}
+
+// renamePlansHost replaces a host named after a log file with the host found in the log
+func (li *LogInfo) renamePlansHost(from string, to string) {
+	for key, doc := range li.plansMap {
+		if doc.Host != from {
+			continue
+		}
+		delete(li.plansMap, key)
+		doc.Host = to
+		nkey := to + "/" + doc.QueryHash
+		if prev, ok := li.plansMap[nkey]; ok {
+			prev.merge(doc)
+		} else {
+			li.plansMap[nkey] = doc
+		}
+	}
+}
+
+// setPlanFlips sets query shapes of more than one plan, most flipped first
+func (li *LogInfo) setPlanFlips() {
+	li.PlanFlips = []PlanFlipsDoc{}
+	for _, doc := range li.plansMap {
+		if len(doc.Plans) > 1 {
+			li.PlanFlips = append(li.PlanFlips, *doc)
+		}
+	}
+	sort.Slice(li.PlanFlips, func(i, j int) bool {
+		if li.PlanFlips[i].NumFlips != li.PlanFlips[j].NumFlips {
+			return li.PlanFlips[i].NumFlips > li.PlanFlips[j].NumFlips
+		}
+		return li.PlanFlips[i].Host+li.PlanFlips[i].QueryHash < li.PlanFlips[j].Host+li.PlanFlips[j].QueryHash
+	})
+}
+
+// printPlanFlips prints query shapes that ran with more than one plan, with latency of each plan
+// and the first plan changes
+func (li *LogInfo) printPlanFlips() string {
+	if len(li.PlanFlips) == 0 {
+		return ""
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Plan flips (%d query shapes):\n", len(li.PlanFlips)))
+	for _, doc := range li.PlanFlips {
+		header := fmt.Sprintf("%v %v %v, queryHash: %v, flips: %d", doc.Command, doc.Namespace, doc.Filter, doc.QueryHash,
+			doc.NumFlips)
+		if doc.Host != "" {
+			header = doc.Host + " " + header
+		}
+		buffer.WriteString(header + "\n")
+		for _, p := range doc.Plans {
+			buffer.WriteString(fmt.Sprintf("  %-40s count: %d, avg ms: %v, max ms: %d, %v to %v\n", p.Plan, p.Count,
+				gox.MilliToTimeString(float64(p.TotalMilli)/float64(p.Count)), p.MaxMilli,
+				p.First.UTC().Format(time.RFC3339), p.Last.UTC().Format(time.RFC3339)))
+		}
+		for i, flip := range doc.Flips {
+			if i == 10 {
+				buffer.WriteString(fmt.Sprintf("  ...and %d more flips\n", doc.NumFlips-i))
+				break
+			}
+			buffer.WriteString(fmt.Sprintf("  %v %v -> %v\n", flip.Time.UTC().Format(time.RFC3339), flip.From, flip.To))
+		}
+	}
+	return buffer.String()
+}
@@ -0,0 +1,196 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// stdinFilename is the file name of logs read from stdin
+const stdinFilename = "-"
+
+// archiveSuffixes are suffixes of archives of many log files, for example support bundles
+var archiveSuffixes = []string{".tar.gz", ".tgz", ".tar", ".zip"}
+
+// getArchiveSuffix returns the archive suffix of a file name, or "" if not an archive
+func getArchiveSuffix(filename string) string {
+	for _, suffix := range archiveSuffixes {
+		if strings.HasSuffix(strings.ToLower(filename), suffix) {
+			return suffix
+		}
+	}
+	return ""
+}
+
+// getOutputPrefix returns the output file name of logs without extensions, for example
+// mongod for mongod.log.gz, bundle for bundle.tar.gz, and stdin for logs from stdin
+func getOutputPrefix(filename string) string {
+	if filename == stdinFilename {
+		return "stdin"
+	}
+	name := filepath.Base(filename)
+	if suffix := getArchiveSuffix(name); suffix != "" {
+		return name[:len(name)-len(suffix)]
+	}
+	name = strings.TrimSuffix(name, ".gz")
+	return strings.TrimSuffix(name, ".log")
+}
+
+// newLogReader returns a reader of plain or gzipped logs, it peeks instead of seeking so that
+// it works with stdin and files in archives
+func newLogReader(r io.Reader) (*bufio.Reader, error) {
+	reader := bufio.NewReader(r)
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return bufio.NewReader(zr), nil
+	}
+	return reader, nil
+}
+
+// countingReader counts bytes read for progress of a stream
+type countingReader struct {
+	count int64
+	r     io.Reader
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.count += int64(n)
+	return n, err
+}
+
+// isArchivedLog returns false for files of an archive that are not logs, for example diagnostic.data
+func isArchivedLog(name string) bool {
+	base := filepath.Base(name)
+	if strings.HasPrefix(base, ".") || strings.Contains(name, "diagnostic.data") ||
+		strings.HasSuffix(name, "-log.bson.gz") || strings.HasSuffix(name, "-index.bson.gz") {
+		return false
+	}
+	return getArchiveSuffix(base) == ""
+}
+
+// parseStdin parses logs from stdin, the size is unknown and progress is the number of lines read
+func (li *LogInfo) parseStdin(opsMap map[string]OpPerformanceDoc) error {
+	reader, err := newLogReader(os.Stdin)
+	if err != nil {
+		return err
+	}
+	progress := func(int) int { return -1 }
+	return li.parseReader(reader, "stdin", opsMap, progress)
+}
+
+// parseArchive parses all log files of a .tar.gz, .tar, or .zip archive, logs are attributed to hosts
+// by their file names or the hosts found in the logs
+func (li *LogInfo) parseArchive(filename string, opsMap map[string]OpPerformanceDoc) error {
+	if getArchiveSuffix(filename) == ".zip" {
+		return li.parseZip(filename, opsMap)
+	}
+	var err error
+	var file *os.File
+	if file, err = os.Open(filename); err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if getArchiveSuffix(filename) != ".tar" {
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(file); err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	var progress func(int) int
+	if fi, err := file.Stat(); err == nil && fi.Size() > 0 {
+		size := fi.Size()
+		progress = func(int) int { // compressed bytes read of the archive
+			pos, _ := file.Seek(0, io.SeekCurrent)
+			return int(100 * pos / size)
+		}
+	}
+	tr := tar.NewReader(r)
+	numLogs := 0
+	for {
+		var header *tar.Header
+		if header, err = tr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg || isArchivedLog(header.Name) == false {
+			continue
+		}
+		if li.parseArchivedLog(tr, header.Name, opsMap, progress) {
+			numLogs++
+		}
+	}
+	if numLogs == 0 {
+		return fmt.Errorf("no log file in %v", filename)
+	}
+	return nil
+}
+
+// parseZip parses all log files of a .zip archive
+func (li *LogInfo) parseZip(filename string, opsMap map[string]OpPerformanceDoc) error {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	numLogs := 0
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || isArchivedLog(f.Name) == false {
+			continue
+		}
+		var rc io.ReadCloser
+		if rc, err = f.Open(); err != nil {
+			return err
+		}
+		cr := &countingReader{r: rc}
+		var progress func(int) int
+		if size := int64(f.UncompressedSize64); size > 0 {
+			progress = func(int) int { return int(100 * cr.count / size) }
+		}
+		if li.parseArchivedLog(cr, f.Name, opsMap, progress) {
+			numLogs++
+		}
+		rc.Close()
+	}
+	if numLogs == 0 {
+		return fmt.Errorf("no log file in %v", filename)
+	}
+	return nil
+}
+
+// parseArchivedLog parses a file of an archive, returns false if it is not a log
+func (li *LogInfo) parseArchivedLog(r io.Reader, name string, opsMap map[string]OpPerformanceDoc,
+	progress func(int) int) bool {
+	reader, err := newLogReader(r)
+	if err != nil {
+		if li.verbose {
+			fmt.Fprintln(os.Stderr, "skip", name, err)
+		}
+		return false
+	}
+	if err = li.parseReader(reader, name, opsMap, progress); err != nil {
+		if li.verbose {
+			fmt.Fprintln(os.Stderr, "skip", name, err)
+		}
+		return false
+	}
+	if li.silent == false {
+		fmt.Fprintln(os.Stderr, "parsed", name)
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const archivedLog = `{"t":{"$date":"2020-08-01T10:00:00.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"Red"},"$db":"keyhole"},"planSummary":"COLLSCAN","docsExamined":1000,"nreturned":4,"durationMillis":120}}`
+
+func TestGetOutputPrefix(t *testing.T) {
+	tests := map[string]string{
+		"-":                      "stdin",
+		"logs/mongod.log.gz":     "mongod",
+		"support/bundle.tar.gz":  "bundle",
+		"support/bundle.tgz":     "bundle",
+		"support/bundle.zip":     "bundle",
+		"logs/shard01a.log.2020": "shard01a.log.2020",
+	}
+	for filename, expected := range tests {
+		if prefix := getOutputPrefix(filename); prefix != expected {
+			t.Fatal("expected", expected, "but got", prefix, "from", filename)
+		}
+	}
+}
+
+func TestNewLogReader(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(archivedLog + "\n"))
+	zw.Close()
+	for _, data := range [][]byte{[]byte(archivedLog + "\n"), buf.Bytes()} {
+		reader, err := newLogReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if str, _ := readLine(reader); str != archivedLog {
+			t.Fatal("unexpected line", str)
+		}
+	}
+}
+
+func TestLogInfoArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyhole")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{"bundle/shard01a/mongod.log": archivedLog, "bundle/shard01b/mongod.log": archivedLog,
+		"bundle/shard01a/diagnostic.data/metrics.1": "metrics"}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	zw.Close()
+	tarball := filepath.Join(dir, "bundle.tar.gz")
+	ioutil.WriteFile(tarball, buf.Bytes(), 0644)
+
+	buf.Reset()
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, _ := w.Create(name)
+		f.Write([]byte(content))
+	}
+	w.Close()
+	zipfile := filepath.Join(dir, "bundle.zip")
+	ioutil.WriteFile(zipfile, buf.Bytes(), 0644)
+
+	for _, filename := range []string{tarball, zipfile} {
+		loginfo := NewLogInfo()
+		loginfo.SetSilent(true)
+		if _, err = loginfo.AnalyzeFiles([]string{filename}, false); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(loginfo.OutputFilename)
+		if strings.HasPrefix(loginfo.OutputFilename, "bundle-") == false {
+			t.Fatal("unexpected output file name", loginfo.OutputFilename)
+		}
+		if len(loginfo.OpsPatterns) != 1 || loginfo.OpsPatterns[0].Count != 2 || len(loginfo.OpsPatterns[0].Hosts) != 2 {
+			t.Fatal("expected a pattern of 2 hosts, but got", loginfo.OpsPatterns)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/simagix/gox"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// poorIndexRatio is docs examined per op or doc returned of a poorly indexed query pattern
+const poorIndexRatio = 10
+
+// IndexRecommendation stores a recommended index of a namespace and query patterns it covers
+type IndexRecommendation struct {
+	Count      int      `json:"count" bson:"count"`           // number of ops of covered patterns
+	Index      string   `json:"index" bson:"index"`           // index keys, for example { color: 1, year: 1 }
+	Key        bson.D   `json:"key" bson:"key"`               // index keys
+	Namespace  string   `json:"ns" bson:"ns"`                 // database.collection
+	Patterns   []string `json:"patterns" bson:"patterns"`     // covered query patterns
+	TotalMilli int      `json:"totalmilli" bson:"totalmilli"` // total milliseconds of covered patterns
+	numEq      int      // number of equality fields
+}
+
+// indexField is a field of an index and its direction
+type indexField struct {
+	direction int
+	name      string
+}
+
+// SetRecommend sets to recommend indexes of COLLSCAN and poorly indexed query patterns
+func (li *LogInfo) SetRecommend(recommend bool) {
+	li.recommend = recommend
+}
+
+// SetIndexesFile sets existing indexes from a saved -index.bson.gz file, recommended indexes
+// already covered by existing indexes are dropped
+func (li *LogInfo) SetIndexesFile(filename string) error {
+	if filename == "" {
+		return nil
+	}
+	ix := NewIndexes(nil)
+	if err := ix.SetIndexesMapFromFile(filename); err != nil {
+		return err
+	}
+	li.existingIndexes = ix.indexesMap
+	return nil
+}
+
+// isPoorlyIndexed returns true if a query pattern is a COLLSCAN or examines many docs per op or doc returned
+func isPoorlyIndexed(doc OpPerformanceDoc) bool {
+	if doc.Scan == COLLSCAN {
+		return true
+	}
+	returned := doc.Returned
+	if returned < doc.Count {
+		returned = doc.Count
+	}
+	return returned > 0 && doc.DocsExamined/returned >= poorIndexRatio
+}
+
+// getRecommendedIndexes returns indexes of a query pattern by the equality, sort, and range rule,
+// one for each branch of $or
+func getRecommendedIndexes(command string, filter string) []IndexRecommendation {
+	var match logDoc
+	var sortDoc logDoc
+	if strings.HasPrefix(filter, "[") { // aggregation pipeline, leading $match stages and the following $sort
+		pipeline, _ := parseLogDoc(filter).([]interface{})
+		for _, v := range pipeline {
+			stage, _ := v.(logDoc)
+			if len(stage) == 0 {
+				break
+			} else if stage[0].key == "$match" {
+				m, _ := stage[0].value.(logDoc)
+				match = append(match, m...)
+				continue
+			} else if stage[0].key == "$sort" {
+				sortDoc, _ = stage[0].value.(logDoc)
+			}
+			break
+		}
+	} else if command == cmdDistinct || strings.HasPrefix(filter, "{") == false {
+		return nil
+	} else {
+		match, _ = parseLogDoc(filter).(logDoc)
+		sortDoc, _ = getLogValue(filter, ", sort: ").(logDoc)
+	}
+
+	branches := []logDoc{nil}
+	if or, ok := match.get("$or").([]interface{}); ok {
+		branches = []logDoc{}
+		for _, v := range or {
+			if branch, ok := v.(logDoc); ok {
+				branches = append(branches, branch)
+			}
+		}
+	}
+	recommendations := []IndexRecommendation{}
+	for _, branch := range branches {
+		eq, rng := []string{}, []string{}
+		addESRFields(match, "", &eq, &rng)
+		addESRFields(branch, "", &eq, &rng)
+		if len(eq) > 0 && eq[0] == "_id" {
+			continue // IDHACK
+		}
+		fields := []indexField{}
+		for _, name := range eq {
+			fields = appendIndexField(fields, indexField{direction: 1, name: name})
+		}
+		numEq := len(fields)
+		for _, e := range sortDoc {
+			direction := 1
+			if s, ok := e.value.(logScalar); ok && strings.HasPrefix(s.raw, "-") {
+				direction = -1
+			}
+			fields = appendIndexField(fields, indexField{direction: direction, name: e.key})
+		}
+		for _, name := range rng {
+			fields = appendIndexField(fields, indexField{direction: 1, name: name})
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		rec := IndexRecommendation{numEq: numEq}
+		for _, f := range fields {
+			rec.Key = append(rec.Key, bson.E{Key: f.name, Value: f.direction})
+		}
+		rec.Index = getIndexKeyString(rec.Key)
+		recommendations = append(recommendations, rec)
+	}
+	return recommendations
+}
+
+// addESRFields adds equality and range fields of a filter shape, $or is handled by the caller
+func addESRFields(doc logDoc, prefix string, eq *[]string, rng *[]string) {
+	for _, e := range doc {
+		if e.key == "$and" {
+			if and, ok := e.value.([]interface{}); ok {
+				for _, v := range and {
+					branch, _ := v.(logDoc)
+					addESRFields(branch, prefix, eq, rng)
+				}
+			}
+			continue
+		} else if strings.HasPrefix(e.key, "$") { // $or, $text, $expr, $where, etc
+			continue
+		}
+		name := prefix + e.key
+		switch v := e.value.(type) {
+		case logScalar:
+			if v.kind != kindRegex {
+				*eq = append(*eq, name)
+			} else if strings.HasPrefix(v.raw, "/^") {
+				*rng = append(*rng, name)
+			} // unanchored regexes scan all keys
+		case []interface{}:
+			*eq = append(*eq, name)
+		case logDoc:
+			isEq, isRange := false, false
+			for _, op := range v {
+				switch op.key {
+				case "$eq", "$in", "$all":
+					isEq = true
+				case "$gt", "$gte", "$lt", "$lte", "$ne", "$nin", "$exists", "$type":
+					isRange = true
+				case "$elemMatch":
+					m, _ := op.value.(logDoc)
+					addESRFields(m, name+".", eq, rng)
+				default:
+					if strings.HasPrefix(op.key, "$") == false { // embedded document
+						isEq = true
+					}
+				}
+			}
+			if isEq {
+				*eq = append(*eq, name)
+			} else if isRange {
+				*rng = append(*rng, name)
+			}
+		}
+	}
+}
+
+// appendIndexField appends a field not in the index
+func appendIndexField(fields []indexField, field indexField) []indexField {
+	for _, f := range fields {
+		if f.name == field.name {
+			return fields
+		}
+	}
+	return append(fields, field)
+}
+
+// getIndexKeyString returns index keys as in logs, for example { color: 1, year: -1 }
+func getIndexKeyString(key bson.D) string {
+	strs := make([]string, 0, len(key))
+	for _, e := range key {
+		strs = append(strs, fmt.Sprintf("%v: %v", e.Key, e.Value))
+	}
+	return "{ " + strings.Join(strs, ", ") + " }"
+}
+
+// isIndexCovered returns true if an index has the fields of a recommended index as its prefix, equality
+// fields in any order
+func isIndexCovered(index bson.D, rec IndexRecommendation) bool {
+	if len(index) < len(rec.Key) {
+		return false
+	}
+	eqs := map[string]bool{}
+	for _, e := range rec.Key[:rec.numEq] {
+		eqs[e.Key] = true
+	}
+	for i, e := range rec.Key {
+		if i < rec.numEq {
+			if eqs[index[i].Key] == false {
+				return false
+			}
+		} else if index[i].Key != e.Key || toInt(index[i].Value) != toInt(e.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// setRecommendations recommends indexes of COLLSCAN and poorly indexed query patterns, merged by
+// namespace and dropped if covered by existing indexes
+func (li *LogInfo) setRecommendations() {
+	li.Recommendations = []IndexRecommendation{}
+	li.numExistingIndexes = 0
+	candidates := map[string][]IndexRecommendation{}
+	for _, doc := range li.OpsPatterns {
+		if isPoorlyIndexed(doc) == false {
+			continue
+		}
+		for _, rec := range getRecommendedIndexes(doc.Command, doc.Filter) {
+			if rec.Index == doc.Index {
+				continue // already used
+			}
+			rec.Count = doc.Count
+			rec.Namespace = doc.Namespace
+			rec.Patterns = []string{doc.Command + " " + doc.Filter}
+			rec.TotalMilli = doc.TotalMilli
+			candidates[doc.Namespace] = append(candidates[doc.Namespace], rec)
+		}
+	}
+	namespaces := []string{}
+	for ns := range candidates {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	for _, ns := range namespaces {
+		list := candidates[ns]
+		sort.SliceStable(list, func(i, j int) bool {
+			if len(list[i].Key) != len(list[j].Key) {
+				return len(list[i].Key) > len(list[j].Key)
+			}
+			return list[i].TotalMilli > list[j].TotalMilli
+		})
+		merged := []IndexRecommendation{}
+		for _, rec := range list {
+			found := false
+			for i := range merged {
+				if isIndexCovered(merged[i].Key, rec) {
+					merged[i].Count += rec.Count
+					merged[i].TotalMilli += rec.TotalMilli
+					merged[i].Patterns = append(merged[i].Patterns, rec.Patterns...)
+					found = true
+					break
+				}
+			}
+			if !found {
+				merged = append(merged, rec)
+			}
+		}
+		sort.SliceStable(merged, func(i, j int) bool { return merged[i].TotalMilli > merged[j].TotalMilli })
+		for _, rec := range merged {
+			if li.isExistingIndex(rec) {
+				li.numExistingIndexes++
+				continue
+			}
+			li.Recommendations = append(li.Recommendations, rec)
+		}
+	}
+}
+
+// isExistingIndex returns true if a recommended index is covered by an existing index
+func (li *LogInfo) isExistingIndex(rec IndexRecommendation) bool {
+	i := strings.Index(rec.Namespace, ".")
+	if li.existingIndexes == nil || i < 0 {
+		return false
+	}
+	for _, index := range li.existingIndexes[rec.Namespace[:i]][rec.Namespace[i+1:]] {
+		if isIndexCovered(index.IndexKey, rec) {
+			return true
+		}
+	}
+	return false
+}
+
+// printRecommendations prints recommended indexes by namespace
+func (li *LogInfo) printRecommendations() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Index recommendations (%d), by equality, sort, and range:\n", len(li.Recommendations)))
+	ns := ""
+	for _, rec := range li.Recommendations {
+		if rec.Namespace != ns {
+			ns = rec.Namespace
+			buffer.WriteString(ns + "\n")
+		}
+		buffer.WriteString(fmt.Sprintf("  %v, %d patterns, %d ops, total ms: %v\n", rec.Index, len(rec.Patterns), rec.Count,
+			gox.MilliToTimeString(float64(rec.TotalMilli))))
+		for _, pattern := range rec.Patterns {
+			buffer.WriteString("    " + pattern + "\n")
+		}
+	}
+	if li.numExistingIndexes > 0 {
+		buffer.WriteString(fmt.Sprintf("%d recommendations dropped, covered by existing indexes\n", li.numExistingIndexes))
+	}
+	return buffer.String()
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGetRecommendedIndexes(t *testing.T) {
+	recs := getRecommendedIndexes("find", `{brand:/^.../i, color:1, year:{$gt:1}}, sort: {price:-1}`)
+	if len(recs) != 1 || recs[0].Index != "{ color: 1, price: -1, brand: 1, year: 1 }" {
+		t.Fatal("unexpected recommendations", recs)
+	}
+	recs = getRecommendedIndexes("find", `{$or:[{color:1}, {brand:1, year:{$gte:1}}], status:1}`)
+	if len(recs) != 2 || recs[0].Index != "{ status: 1, color: 1 }" || recs[1].Index != "{ status: 1, brand: 1, year: 1 }" {
+		t.Fatal("unexpected recommendations", recs)
+	}
+	recs = getRecommendedIndexes("aggregate", `[{$match:{b.country:1, year:{$gte:1}}}, {$sort:{total:-1}}, {$limit:1}]`)
+	if len(recs) != 1 || recs[0].Index != "{ b.country: 1, total: -1, year: 1 }" {
+		t.Fatal("unexpected recommendations", recs)
+	}
+	if recs = getRecommendedIndexes("update", `{_id:1}`); len(recs) != 0 {
+		t.Fatal("unexpected recommendations", recs)
+	}
+}
+
+func TestLogInfoRecommendations(t *testing.T) {
+	loginfo := NewLogInfo()
+	loginfo.SetRecommend(true)
+	loginfo.OpsPatterns = []OpPerformanceDoc{
+		{Command: "find", Count: 10, DocsExamined: 50000, Filter: `{color:1}`, Namespace: "keyhole.cars", Scan: COLLSCAN, TotalMilli: 3000},
+		{Command: "find", Count: 5, DocsExamined: 25000, Filter: `{color:1, year:{$gt:1}}`, Namespace: "keyhole.cars", Scan: COLLSCAN, TotalMilli: 2000},
+		{Command: "find", Count: 5, DocsExamined: 5000, Filter: `{dealer:1}`, Namespace: "keyhole.cars", Returned: 4000, TotalMilli: 200},
+		{Command: "update", Count: 5, DocsExamined: 20000, Filter: `{vin:1}`, Index: "{ make: 1 }", Namespace: "keyhole.cars", TotalMilli: 800},
+	}
+	loginfo.setRecommendations()
+	if len(loginfo.Recommendations) != 2 {
+		t.Fatal("expected 2 recommendations, but got", loginfo.Recommendations)
+	}
+	if rec := loginfo.Recommendations[0]; rec.Index != "{ color: 1, year: 1 }" || len(rec.Patterns) != 2 || rec.Count != 15 {
+		t.Fatal("unexpected recommendation", rec)
+	}
+	if rec := loginfo.Recommendations[1]; rec.Index != "{ vin: 1 }" {
+		t.Fatal("unexpected recommendation", rec)
+	}
+
+	loginfo.existingIndexes = map[string]CollectionIndexes{"keyhole": {"cars": []IndexStatsDoc{
+		{IndexKey: bson.D{{Key: "color", Value: int32(1)}, {Key: "year", Value: int32(1)}, {Key: "brand", Value: int32(1)}}}}}}
+	loginfo.setRecommendations()
+	if len(loginfo.Recommendations) != 1 || loginfo.numExistingIndexes != 1 {
+		t.Fatal("expected existing index dropped, but got", loginfo.Recommendations)
+	}
+	t.Log(loginfo.printRecommendations())
+}
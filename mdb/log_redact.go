@@ -0,0 +1,298 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+)
+
+// redactedKeys are fields of a command whose literal values are masked, the values of any field
+// under them are masked as well. The update command is masked only of a document, not its collection.
+var redactedKeys = map[string]bool{"deletes": true, "documents": true, "filter": true, "keyValue": true,
+	"pipeline": true, "q": true, "query": true, "u": true, "update": true, "updates": true}
+
+// keptKeys are fields of filters, updates, and pipelines whose values are kept, for example sort directions
+var keptKeys = map[string]bool{"$limit": true, "$options": true, "$skip": true, "$sort": true,
+	"batchSize": true, "hint": true, "limit": true, "options": true, "skip": true, "sort": true}
+
+// projectionKeys are fields of projections, field paths and inclusions, 0, 1, true, and false, are
+// kept and other literals, for example of $cond or $literal, are masked
+var projectionKeys = map[string]bool{"$project": true, "projection": true}
+
+// textDocRegex matches beginning of documents of a text log line to redact, including arguments of
+// assertions of commands in warnings and errors, and keys of duplicate key errors
+var textDocRegex = regexp.MustCompile(`(\b(?:command|originatingCommand|query|update|dup key): (?:\w+ )?|\bwith arguments ')\{`)
+
+// redactLogs redacts literal values of logged lines of the report, slow ops and issue samples
+func (li *LogInfo) redactLogs() {
+	for i := range li.SlowOps {
+		li.SlowOps[i].Log = redactLogLine(li.SlowOps[i].Log)
+	}
+	for i := range li.Issues {
+		li.Issues[i].Sample = redactLogLine(li.Issues[i].Sample)
+	}
+}
+
+// redactLogLine masks literal values of filters, updates, and pipelines of a text or logv2 log line,
+// strings, numbers, dates, and ObjectIds are replaced with tokens of their hash so that the same value
+// always masks to the same token. Field names, plan summary, and metrics are kept.
+func redactLogLine(str string) string {
+	if strings.HasPrefix(str, "{") { // logv2
+		r := &logRedactor{str: str}
+		r.redactValue(false, "")
+		return r.buffer.String() + str[r.pos:]
+	}
+	var buffer strings.Builder
+	pos := 0
+	for pos < len(str) {
+		loc := textDocRegex.FindStringSubmatchIndex(str[pos:])
+		if loc == nil {
+			break
+		}
+		label := str[pos+loc[2] : pos+loc[3]]
+		buffer.WriteString(str[pos : pos+loc[3]])
+		r := &logRedactor{pos: pos + loc[3], str: str}
+		r.redactValue(strings.HasPrefix(label, "query") || strings.HasPrefix(label, "update") ||
+			strings.HasPrefix(label, "dup key"), "")
+		buffer.WriteString(r.buffer.String())
+		pos = r.pos
+	}
+	buffer.WriteString(str[pos:])
+	return buffer.String()
+}
+
+// logRedactor copies a document of a log line and masks its literal values
+type logRedactor struct {
+	buffer    strings.Builder
+	pos       int
+	projected bool // in a projection, inclusions are kept
+	str       string
+}
+
+// redactValue copies a value, masked if redacted, key is the field of the value
+func (r *logRedactor) redactValue(redacted bool, key string) {
+	r.copySpaces()
+	if r.pos >= len(r.str) {
+		return
+	}
+	c := r.str[r.pos]
+	switch {
+	case c == '{':
+		r.redactDoc(redacted)
+	case c == '[':
+		r.redactArray(redacted, key)
+	case c == '"' || c == '\'':
+		begin := r.pos
+		r.skipString()
+		value := r.str[begin+1 : r.pos-1]
+		if redacted && strings.HasPrefix(value, "$") == false {
+			r.buffer.WriteString(string(c) + getRedactedToken(getRedactedKind(key), value) + string(c))
+		} else if c == '"' && strings.Contains(value, "dup key: {") { // errMsg of logv2
+			r.buffer.WriteString(redactQuotedText(r.str[begin:r.pos]))
+		} else {
+			r.buffer.WriteString(r.str[begin:r.pos])
+		}
+	case c == '/':
+		begin := r.pos
+		p := &logDocParser{pos: r.pos, str: r.str}
+		re := p.parseRegex()
+		r.pos = p.pos
+		if redacted == false {
+			r.buffer.WriteString(re)
+			break
+		}
+		i := strings.LastIndex(re, "/")
+		if i <= 0 {
+			i = len(re)
+		}
+		anchor := ""
+		if strings.HasPrefix(re, "/^") {
+			anchor = "^"
+		}
+		r.buffer.WriteString("/" + anchor + getRedactedToken("r", r.str[begin+1:begin+i]) + re[i:])
+	default:
+		begin := r.pos
+		token := r.parseToken()
+		if token == "" { // unexpected character
+			r.buffer.WriteByte(c)
+			r.pos++
+			return
+		} else if c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9') {
+			if redacted && (r.projected == false || (token != "0" && token != "1")) {
+				r.buffer.WriteString(`"` + getRedactedToken("n", token) + `"`)
+			} else {
+				r.buffer.WriteString(token)
+			}
+			return
+		}
+		r.buffer.WriteString(r.str[begin:r.pos])
+		if token == "new" { // new Date(1589169600000)
+			r.redactValue(redacted, key)
+			return
+		}
+		r.copySpaces()
+		if r.pos < len(r.str) && r.str[r.pos] == '(' {
+			r.redactArgs(redacted, token)
+		}
+	}
+}
+
+// redactDoc copies a document, values of redactedKeys are masked
+func (r *logRedactor) redactDoc(redacted bool) {
+	r.buffer.WriteByte('{')
+	r.pos++
+	for {
+		r.copySpaces()
+		if r.pos >= len(r.str) {
+			return
+		}
+		c := r.str[r.pos]
+		if c == '}' {
+			r.buffer.WriteByte(c)
+			r.pos++
+			return
+		} else if c == ',' {
+			r.buffer.WriteByte(c)
+			r.pos++
+			continue
+		}
+		begin := r.pos
+		key := ""
+		if c == '"' || c == '\'' {
+			r.skipString()
+			key = r.str[begin+1 : r.pos-1]
+		} else {
+			key = r.parseToken()
+		}
+		r.buffer.WriteString(r.str[begin:r.pos])
+		r.copySpaces()
+		if r.pos < len(r.str) && r.str[r.pos] == ':' {
+			r.buffer.WriteByte(':')
+			r.pos++
+		} else if key == "" { // unexpected character
+			r.buffer.WriteByte(c)
+			r.pos++
+			continue
+		}
+		r.copySpaces()
+		masked := redactedKeys[key]
+		if key == "update" && r.pos < len(r.str) { // update command of a collection or findAndModify of a document
+			masked = r.str[r.pos] == '{' || r.str[r.pos] == '['
+		}
+		if projectionKeys[key] {
+			projected := r.projected
+			r.projected = true
+			r.redactValue(true, key)
+			r.projected = projected
+			continue
+		}
+		r.redactValue((redacted || masked) && keptKeys[key] == false, key)
+	}
+}
+
+// redactArray copies an array, elements are masked if redacted
+func (r *logRedactor) redactArray(redacted bool, key string) {
+	r.buffer.WriteByte('[')
+	r.pos++
+	for {
+		r.copySpaces()
+		if r.pos >= len(r.str) {
+			return
+		}
+		c := r.str[r.pos]
+		if c == ']' || c == ',' {
+			r.buffer.WriteByte(c)
+			r.pos++
+			if c == ']' {
+				return
+			}
+			continue
+		}
+		pos := r.pos
+		r.redactValue(redacted, key)
+		if r.pos == pos { // unexpected character
+			r.buffer.WriteByte(c)
+			r.pos++
+		}
+	}
+}
+
+// redactArgs copies arguments in parentheses of a constructor, for example ObjectId('...'), masked as
+// one token if redacted
+func (r *logRedactor) redactArgs(redacted bool, name string) {
+	p := &logDocParser{pos: r.pos, str: r.str}
+	args := p.parseParens()
+	r.pos = p.pos
+	value := strings.Trim(args, "()")
+	if redacted == false || value == "" {
+		r.buffer.WriteString(args)
+		return
+	}
+	quote := `"`
+	if strings.HasPrefix(value, "'") {
+		quote = "'"
+	}
+	r.buffer.WriteString("(" + quote + getRedactedToken(getRedactedKind(name), strings.Trim(value, `"'`)) + quote + ")")
+}
+
+// parseToken returns a key, a number, or a name
+func (r *logRedactor) parseToken() string {
+	p := &logDocParser{pos: r.pos, str: r.str}
+	token := p.parseToken()
+	r.pos = p.pos
+	return token
+}
+
+func (r *logRedactor) skipString() {
+	p := &logDocParser{pos: r.pos, str: r.str}
+	p.parseString()
+	r.pos = p.pos
+}
+
+func (r *logRedactor) copySpaces() {
+	for r.pos < len(r.str) && strings.IndexByte(" \t\r\n", r.str[r.pos]) >= 0 {
+		r.buffer.WriteByte(r.str[r.pos])
+		r.pos++
+	}
+}
+
+// redactQuotedText masks documents of a JSON string of text, for example keys of a duplicate key error
+func redactQuotedText(quoted string) string {
+	var text string
+	if err := json.Unmarshal([]byte(quoted), &text); err != nil {
+		return quoted
+	}
+	var buffer bytes.Buffer
+	enc := json.NewEncoder(&buffer)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(redactLogLine(text)); err != nil {
+		return quoted
+	}
+	return strings.TrimSuffix(buffer.String(), "\n")
+}
+
+// getRedactedKind returns kind of a masked value from its field or constructor, d for dates, n for
+// numbers, o for ObjectIds, and s for strings
+func getRedactedKind(name string) string {
+	switch name {
+	case "$date", "Date", "ISODate":
+		return "d"
+	case "$numberDecimal", "$numberDouble", "$numberInt", "$numberLong", "NumberDecimal", "NumberInt", "NumberLong":
+		return "n"
+	case "$oid", "ObjectId":
+		return "o"
+	}
+	return "s"
+}
+
+// getRedactedToken returns a token of a value, for example s_1c9d44a7
+func getRedactedToken(kind string, value string) string {
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	return fmt.Sprintf("%v_%08x", kind, h.Sum32())
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestRedactLogLine(t *testing.T) {
+	str := `2020-05-11T04:00:00.123+0000 I  COMMAND  [conn12] command keyhole.cars appName: "orders" command: find { find: "cars", filter: { color: "Red", year: { $gt: 2015 }, dealer: ObjectId('5eb8a6e4c8ab2a5a0d3f1e21'), sold: new Date(1589169600000), vin: /^1HG/i }, sort: { price: -1 }, limit: 10, $db: "keyhole" } planSummary: IXSCAN { color: 1 } keysExamined:100 docsExamined:100 numYields:0 nreturned:10 reslen:1234 protocol:op_msg 1200ms`
+	redacted := redactLogLine(str)
+	t.Log(redacted)
+	for _, literal := range []string{`"Red"`, "2015", "5eb8a6e4c8ab2a5a0d3f1e21", "1589169600000", "1HG"} {
+		if strings.Contains(redacted, literal) {
+			t.Fatal("expected", literal, "redacted, but got", redacted)
+		}
+	}
+	for _, kept := range []string{`find: "cars"`, "sort: { price: -1 }", "limit: 10", "planSummary: IXSCAN { color: 1 }",
+		"vin: /^r_", "ObjectId('o_", "new Date(\"d_", "nreturned:10", "1200ms"} {
+		if strings.Contains(redacted, kept) == false {
+			t.Fatal("expected", kept, "kept, but got", redacted)
+		}
+	}
+	if redactLogLine(str) != redacted {
+		t.Fatal("expected the same redacted line")
+	}
+	stat, err := NewLogInfo().ParseLog(redacted)
+	if err != nil || stat.op != cmdFind || stat.filter != "{color:1, dealer:1, sold:1, vin:/^.../i, year:{$gt:1}}, sort: {price:-1}" {
+		t.Fatal("expected the same query pattern, but got", stat.filter, err)
+	}
+
+	str = `{"t":{"$date":"2020-05-11T04:00:00.123+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"aggregate":"cars","pipeline":[{"$match":{"color":"Red","dealer":{"$oid":"5eb8a6e4c8ab2a5a0d3f1e21"}}},{"$group":{"_id":"$year","total":{"$sum":"$price"}}},{"$sort":{"total":-1}}],"$db":"keyhole"},"planSummary":"IXSCAN { color: 1 }","docsExamined":100,"nreturned":10,"durationMillis":1200}}`
+	redacted = redactLogLine(str)
+	t.Log(redacted)
+	for _, literal := range []string{`"Red"`, "5eb8a6e4c8ab2a5a0d3f1e21"} {
+		if strings.Contains(redacted, literal) {
+			t.Fatal("expected", literal, "redacted, but got", redacted)
+		}
+	}
+	for _, kept := range []string{`"aggregate":"cars"`, `"color":"s_`, `{"$oid":"o_`, `"_id":"$year"`, `{"$sort":{"total":-1}}`,
+		`"planSummary":"IXSCAN { color: 1 }"`, `"durationMillis":1200`, `"t":{"$date":"2020-05-11T04:00:00.123+00:00"}`} {
+		if strings.Contains(redacted, kept) == false {
+			t.Fatal("expected", kept, "kept, but got", redacted)
+		}
+	}
+	if strings.Index(redacted, getRedactedToken("s", "Red")) < 0 {
+		t.Fatal("expected the same token of the same value, but got", redacted)
+	}
+
+	lines := []string{ // projections, duplicate keys, and the update command
+		`{"t":{"$date":"2020-05-11T04:00:00.123+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.users","command":{"aggregate":"users","pipeline":[{"$project":{"name":1,"_id":0,"flagged":{"$cond":[{"$eq":["$ssn","123-45-6789"]},true,false]}}}],"$db":"keyhole"},"durationMillis":1200}}`,
+		`{"t":{"$date":"2020-05-11T04:00:00.123+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.users","command":{"find":"users","filter":{},"projection":{"name":true,"tag":{"$literal":"vip-alice"}},"$db":"keyhole"},"durationMillis":1200}}`,
+		`{"t":{"$date":"2020-05-11T04:00:00.123+00:00"},"s":"I","c":"WRITE","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"update","ns":"keyhole.users","command":{"q":{"_id":1},"u":{"$set":{"email":"alice@x.com"}}},"keyPattern":{"email":1},"keyValue":{"email":"alice@x.com"},"errMsg":"E11000 duplicate key error collection: keyhole.users index: email_1 dup key: { email: \"alice@x.com\" }","errCode":11000,"durationMillis":1200}}`,
+		`2020-05-11T04:00:00.123+0000 I  WRITE    [conn12] update keyhole.users command: { q: { _id: 1 }, u: { $set: { email: "alice@x.com" } } } exception: E11000 duplicate key error collection: keyhole.users index: email_1 dup key: { : "alice@x.com" } code:11000 1200ms`,
+		`{"t":{"$date":"2020-05-11T04:00:00.123+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.users","command":{"update":"users","updates":[{"q":{"name":"alice"},"u":{"$set":{"tier":"gold"}}}],"$db":"keyhole"},"durationMillis":1200}}`,
+	}
+	kepts := [][]string{
+		{`"name":1`, `"_id":0`, `"$ssn"`, `,true,false]`},
+		{`"find":"users"`, `"name":true`},
+		{`"keyPattern":{"email":1}`, `"keyValue":{"email":"s_`, `dup key: { email: \"s_`},
+		{`dup key: { : "s_`, "code:11000"},
+		{`"update":"users"`, `"tier":"s_`},
+	}
+	for i, str := range lines {
+		redacted = redactLogLine(str)
+		t.Log(redacted)
+		for _, literal := range []string{"123-45-6789", "vip-alice", "alice@x.com", `"alice"`, `"gold"`} {
+			if strings.Contains(redacted, literal) {
+				t.Fatal("expected", literal, "redacted, but got", redacted)
+			}
+		}
+		for _, kept := range kepts[i] {
+			if strings.Contains(redacted, kept) == false {
+				t.Fatal("expected", kept, "kept, but got", redacted)
+			}
+		}
+	}
+}
+
+func TestRedactLogsIssues(t *testing.T) {
+	lines := []string{
+		`2020-05-12T12:50:18.000-0400 W  QUERY    [conn6801] Plan executor error during find command: FAILURE, query: { color: "Red", vin: "1HGCM82633A004352" }`,
+		`2020-05-12T12:50:19.000-0400 E  COMMAND  [conn6802] Assertion while executing command 'find' on database 'keyhole' with arguments '{ find: "cars", filter: { color: "Blue" } }': interrupted`,
+	}
+	loginfo := NewLogInfo()
+	loginfo.SetSilent(true)
+	if err := loginfo.Parse(bufio.NewReader(strings.NewReader(strings.Join(lines, "\n")))); err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.Issues) != 2 {
+		t.Fatal("expected 2 issues, but got", len(loginfo.Issues))
+	}
+	loginfo.redactLogs()
+	for _, issue := range loginfo.Issues {
+		t.Log(issue.Sample)
+		for _, literal := range []string{`"Red"`, "1HGCM82633A004352", `"Blue"`} {
+			if strings.Contains(issue.Sample, literal) {
+				t.Fatal("expected", literal, "redacted, but got", issue.Sample)
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TimelineDoc stores slow ops stats of a namespace and a command in a minute
+type TimelineDoc struct {
+	Collscan   int       `bson:"collscan"`   // number of COLLSCAN
+	Command    string    `bson:"command"`    // count, delete, find, remove, and update
+	Count      int       `bson:"count"`      // number of ops
+	Minute     time.Time `bson:"minute"`     // beginning of the minute
+	Namespace  string    `bson:"ns"`         // database.collectin
+	TotalMilli int       `bson:"totalmilli"` // total milliseconds
+}
+
+// timelineSeries holds total milliseconds of a namespace and a command in columns
+type timelineSeries struct {
+	collscan   int
+	count      int
+	label      string
+	milli      []int
+	totalMilli int
+}
+
+const maxSparklineWidth = 60
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// addTimeline adds a slow op to its minute bucket
+func (li *LogInfo) addTimeline(stat LogStats) {
+	if stat.utc.IsZero() {
+		return
+	}
+	if li.timelineMap == nil {
+		li.timelineMap = map[string]TimelineDoc{}
+	}
+	minute := stat.utc.UTC().Truncate(time.Minute)
+	key := minute.Format(time.RFC3339) + " " + stat.ns + " " + stat.op
+	doc, ok := li.timelineMap[key]
+	if !ok {
+		doc = TimelineDoc{Command: stat.op, Minute: minute, Namespace: stat.ns}
+	}
+	doc.Count++
+	doc.TotalMilli += stat.milli
+	if stat.scan == COLLSCAN {
+		doc.Collscan++
+	}
+	li.timelineMap[key] = doc
+}
+
+// setTimeline sets timeline from the timeline map, sorted by time
+func (li *LogInfo) setTimeline() {
+	li.Timeline = make([]TimelineDoc, 0, len(li.timelineMap))
+	for _, doc := range li.timelineMap {
+		li.Timeline = append(li.Timeline, doc)
+	}
+	sort.Slice(li.Timeline, func(i, j int) bool {
+		if li.Timeline[i].Minute.Equal(li.Timeline[j].Minute) == false {
+			return li.Timeline[i].Minute.Before(li.Timeline[j].Minute)
+		}
+		if li.Timeline[i].Namespace != li.Timeline[j].Namespace {
+			return li.Timeline[i].Namespace < li.Timeline[j].Namespace
+		}
+		return li.Timeline[i].Command < li.Timeline[j].Command
+	})
+}
+
+// printTimeline prints sparklines of total milliseconds per namespace and command
+func (li *LogInfo) printTimeline() string {
+	if len(li.Timeline) == 0 {
+		return ""
+	}
+	begin := li.Timeline[0].Minute
+	end := li.Timeline[len(li.Timeline)-1].Minute
+	minutes := int(end.Sub(begin)/time.Minute) + 1
+	step := (minutes + maxSparklineWidth - 1) / maxSparklineWidth
+	width := (minutes + step - 1) / step
+
+	all := &timelineSeries{label: "all", milli: make([]int, width)}
+	seriesMap := map[string]*timelineSeries{}
+	list := []*timelineSeries{}
+	for _, doc := range li.Timeline {
+		label := doc.Namespace + " " + doc.Command
+		s, ok := seriesMap[label]
+		if !ok {
+			s = &timelineSeries{label: label, milli: make([]int, width)}
+			seriesMap[label] = s
+			list = append(list, s)
+		}
+		pos := int(doc.Minute.Sub(begin)/time.Minute) / step
+		for _, x := range []*timelineSeries{s, all} {
+			x.collscan += doc.Collscan
+			x.count += doc.Count
+			x.milli[pos] += doc.TotalMilli
+			x.totalMilli += doc.TotalMilli
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].totalMilli > list[j].totalMilli })
+
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Timeline of slow ops, total ms per %d minute(s), %v to %v:\n",
+		step, begin.Format("2006-01-02T15:04Z"), end.Format("2006-01-02T15:04Z")))
+	for _, s := range append([]*timelineSeries{all}, list...) {
+		label := s.label
+		if len(label) > 40 {
+			label = label[:1] + "*" + label[len(label)-38:]
+		}
+		buffer.WriteString(fmt.Sprintf("%-40s %-*s count: %d, total ms: %d, COLLSCAN: %d\n",
+			label, width, sparkline(s.milli), s.count, s.totalMilli, s.collscan))
+	}
+	return buffer.String()
+}
+
+// sparkline returns a sparkline of values
+func sparkline(values []int) string {
+	max := 0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	runes := make([]rune, len(values))
+	for i, v := range values {
+		if v == 0 {
+			runes[i] = ' '
+		} else {
+			runes[i] = sparks[(len(sparks)-1)*v/max]
+		}
+	}
+	return string(runes)
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TransactionsDoc stores stats of multi-document transactions
+type TransactionsDoc struct {
+	AbortCauses   map[string]int `json:"abortcauses" bson:"abortcauses"`     // aborted by errName
+	Aborted       int            `json:"aborted" bson:"aborted"`             // number of aborted
+	Committed     int            `json:"committed" bson:"committed"`         // number of committed
+	Count         int            `json:"count" bson:"count"`                 // number of transactions
+	Duration      Histogram      `json:"duration" bson:"duration"`           // duration in milliseconds
+	Inactive      Histogram      `json:"inactive" bson:"inactive"`           // time inactive in milliseconds
+	MaxInactive   int            `json:"maxinactive" bson:"maxinactive"`     // max inactive milliseconds
+	MaxMilli      int            `json:"maxmilli" bson:"maxmilli"`           // max duration milliseconds
+	Namespaces    map[string]int `json:"namespaces" bson:"namespaces"`       // transactions by namespace touched
+	ReadConcerns  map[string]int `json:"readconcerns" bson:"readconcerns"`   // transactions by read concern level
+	TotalInactive int            `json:"totalinactive" bson:"totalinactive"` // total inactive milliseconds
+	TotalMilli    int            `json:"totalmilli" bson:"totalmilli"`       // total duration milliseconds
+}
+
+// txnStat holds a transaction parsed from a logv2 "transaction" line
+type txnStat struct {
+	cause       string // errName or terminationCause of an aborted transaction
+	committed   bool
+	inactive    int
+	key         string
+	milli       int
+	readConcern string
+}
+
+// getLogTransaction returns a transaction of a logv2 line, or nil
+func getLogTransaction(line logLine) *txnStat {
+	if line.component != "TXN" || line.message != "transaction" || line.attrs == nil {
+		return nil
+	}
+	txn := txnStat{cause: fmt.Sprintf("%v", line.attrs["terminationCause"]), committed: line.attrs["terminationCause"] == "committed",
+		inactive: toInt(line.attrs["timeInactiveMicros"]) / 1000, milli: toInt(line.attrs["durationMillis"])}
+	if line.attrs["errName"] != nil {
+		txn.cause = fmt.Sprintf("%v", line.attrs["errName"])
+	}
+	if params, ok := line.attrs["parameters"].(map[string]interface{}); ok {
+		txn.key = getTxnKey(params)
+		if rc, ok := params["readConcern"].(map[string]interface{}); ok && rc["level"] != nil {
+			txn.readConcern = fmt.Sprintf("%v", rc["level"])
+		}
+	}
+	return &txn
+}
+
+// getTxnKey returns lsid and txnNumber of a command or transaction parameters
+func getTxnKey(doc map[string]interface{}) string {
+	if doc["txnNumber"] == nil {
+		return ""
+	}
+	lsid, ok := doc["lsid"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	id := fmt.Sprintf("%v", lsid["id"])
+	if m, ok := lsid["id"].(map[string]interface{}); ok && m["$uuid"] != nil {
+		id = fmt.Sprintf("%v", m["$uuid"])
+	}
+	return fmt.Sprintf("%v:%v", id, toInt(doc["txnNumber"]))
+}
+
+// addTxnNamespace keeps namespace of an op in a transaction
+func (li *LogInfo) addTxnNamespace(key string, ns string) {
+	if li.txnNamespaces == nil {
+		li.txnNamespaces = map[string][]string{}
+	}
+	for _, v := range li.txnNamespaces[key] {
+		if v == ns {
+			return
+		}
+	}
+	li.txnNamespaces[key] = append(li.txnNamespaces[key], ns)
+}
+
+// addTransaction adds a completed transaction, namespaces are from its ops logged before
+func (li *LogInfo) addTransaction(txn txnStat) {
+	doc := &li.Transactions
+	if doc.Count == 0 {
+		*doc = TransactionsDoc{AbortCauses: map[string]int{}, Duration: NewHistogram(), Inactive: NewHistogram(),
+			Namespaces: map[string]int{}, ReadConcerns: map[string]int{}}
+	}
+	doc.Count++
+	if txn.committed {
+		doc.Committed++
+	} else {
+		doc.Aborted++
+		doc.AbortCauses[txn.cause]++
+	}
+	doc.Duration.Add(txn.milli)
+	doc.Inactive.Add(txn.inactive)
+	doc.TotalMilli += txn.milli
+	doc.TotalInactive += txn.inactive
+	if txn.milli > doc.MaxMilli {
+		doc.MaxMilli = txn.milli
+	}
+	if txn.inactive > doc.MaxInactive {
+		doc.MaxInactive = txn.inactive
+	}
+	if txn.readConcern != "" {
+		doc.ReadConcerns[txn.readConcern]++
+	}
+	if txn.key != "" {
+		for _, ns := range li.txnNamespaces[txn.key] {
+			doc.Namespaces[ns]++
+		}
+		delete(li.txnNamespaces, txn.key)
+	}
+}
+
+// printTransactions prints stats of transactions
+func (li *LogInfo) printTransactions() string {
+	doc := li.Transactions
+	if doc.Count == 0 {
+		return ""
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("Transactions: %d, committed: %d, aborted: %d\n", doc.Count, doc.Committed, doc.Aborted))
+	buffer.WriteString(fmt.Sprintf("  duration ms: avg %d, p50 %d, p95 %d, p99 %d, max %d\n", doc.TotalMilli/doc.Count,
+		doc.Duration.Percentile(50, doc.MaxMilli), doc.Duration.Percentile(95, doc.MaxMilli),
+		doc.Duration.Percentile(99, doc.MaxMilli), doc.MaxMilli))
+	buffer.WriteString(fmt.Sprintf("  inactive ms: avg %d, p50 %d, p95 %d, p99 %d, max %d\n", doc.TotalInactive/doc.Count,
+		doc.Inactive.Percentile(50, doc.MaxInactive), doc.Inactive.Percentile(95, doc.MaxInactive),
+		doc.Inactive.Percentile(99, doc.MaxInactive), doc.MaxInactive))
+	for _, m := range []struct {
+		label  string
+		counts map[string]int
+	}{{"abort causes", doc.AbortCauses}, {"read concerns", doc.ReadConcerns}, {"namespaces", doc.Namespaces}} {
+		if len(m.counts) > 0 {
+			buffer.WriteString(fmt.Sprintf("  %v: %v\n", m.label, getSortedCounts(m.counts)))
+		}
+	}
+	return buffer.String()
+}
+
+// getSortedCounts returns counts in descending order, for example WriteConflict: 3, NoSuchTransaction: 1
+func getSortedCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	strs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		strs = append(strs, fmt.Sprintf("%v: %d", k, counts[k]))
+	}
+	return strings.Join(strs, ", ")
+}
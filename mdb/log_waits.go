@@ -0,0 +1,98 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// WaitsDoc stores where time of ops went other than executing, in microseconds
+type WaitsDoc struct {
+	BytesRead          int `json:"bytesread" bson:"bytesread"`                   // bytes read from disk
+	DiskReadMicros     int `json:"diskreadmicros" bson:"diskreadmicros"`         // storage.data.timeReadingMicros
+	FlowControlMicros  int `json:"flowcontrolmicros" bson:"flowcontrolmicros"`   // flowControl.timeAcquiringMicros
+	LockMicros         int `json:"lockmicros" bson:"lockmicros"`                 // locks.*.timeAcquiringMicros
+	WriteConcernMicros int `json:"writeconcernmicros" bson:"writeconcernmicros"` // waitForWriteConcernDurationMillis
+}
+
+// add adds waits of an op or of another query pattern
+func (w *WaitsDoc) add(b WaitsDoc) {
+	w.BytesRead += b.BytesRead
+	w.DiskReadMicros += b.DiskReadMicros
+	w.FlowControlMicros += b.FlowControlMicros
+	w.LockMicros += b.LockMicros
+	w.WriteConcernMicros += b.WriteConcernMicros
+}
+
+// getLogv2Waits returns lock, disk read, flow control, and write concern waits of a logv2 slow op
+func getLogv2Waits(attr map[string]interface{}) WaitsDoc {
+	waits := WaitsDoc{WriteConcernMicros: 1000 * toInt(attr["waitForWriteConcernDurationMillis"])}
+	if locks, ok := attr["locks"].(map[string]interface{}); ok {
+		for _, v := range locks {
+			lock, _ := v.(map[string]interface{})
+			if micros, ok := lock["timeAcquiringMicros"].(map[string]interface{}); ok {
+				for _, m := range micros {
+					waits.LockMicros += toInt(m)
+				}
+			}
+		}
+	}
+	if storage, ok := attr["storage"].(map[string]interface{}); ok {
+		if data, ok := storage["data"].(map[string]interface{}); ok {
+			waits.BytesRead = toInt(data["bytesRead"])
+			waits.DiskReadMicros = toInt(data["timeReadingMicros"])
+		}
+	}
+	if flowControl, ok := attr["flowControl"].(map[string]interface{}); ok {
+		waits.FlowControlMicros = toInt(flowControl["timeAcquiringMicros"])
+	}
+	return waits
+}
+
+var writeConcernWaitRegex = regexp.MustCompile(`\bwaitForWriteConcernDurationMillis:(\d+)`)
+
+// getTextWaits returns lock, disk read, flow control, and write concern waits of a text slow op
+func getTextWaits(str string) WaitsDoc {
+	waits := WaitsDoc{}
+	if result := writeConcernWaitRegex.FindStringSubmatch(str); result != nil {
+		waits.WriteConcernMicros = 1000 * toInt(result[1])
+	}
+	if locks, ok := getLogValue(str, " locks:").(logDoc); ok {
+		for _, lock := range locks {
+			resource, _ := lock.value.(logDoc)
+			for _, m := range resource.getDoc("timeAcquiringMicros") {
+				waits.LockMicros += getScalarInt(m.value)
+			}
+		}
+	}
+	if storage, ok := getLogValue(str, " storage:").(logDoc); ok {
+		data := storage.getDoc("data")
+		waits.BytesRead = getScalarInt(data.get("bytesRead"))
+		waits.DiskReadMicros = getScalarInt(data.get("timeReadingMicros"))
+	}
+	if flowControl, ok := getLogValue(str, " flowControl:").(logDoc); ok {
+		waits.FlowControlMicros = getScalarInt(flowControl.get("timeAcquiringMicros"))
+	}
+	return waits
+}
+
+// getScalarInt returns the number of a logScalar, or 0
+func getScalarInt(v interface{}) int {
+	if s, ok := v.(logScalar); ok && s.kind == kindNumber {
+		return toInt(s.raw)
+	}
+	return 0
+}
+
+// getWaitsString returns percentages of total time waiting for locks, disk reads, write concern, and
+// flow control, for example 5/40/0/0, or - if no waits logged
+func getWaitsString(doc OpPerformanceDoc) string {
+	w := doc.Waits
+	if doc.TotalMilli == 0 || w.LockMicros+w.DiskReadMicros+w.WriteConcernMicros+w.FlowControlMicros == 0 {
+		return "-"
+	}
+	pct := func(micros int) int { return micros / (10 * doc.TotalMilli) }
+	return fmt.Sprintf("%d/%d/%d/%d", pct(w.LockMicros), pct(w.DiskReadMicros), pct(w.WriteConcernMicros),
+		pct(w.FlowControlMicros))
+}
@@ -0,0 +1,38 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestLogInfoWaits(t *testing.T) {
+	lines := []string{
+		`{"t":{"$date":"2020-08-01T10:00:00.000+00:00"},"s":"I","c":"WRITE","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"update","ns":"keyhole.cars","command":{"q":{"vin":"1HG"},"u":{"$set":{"sold":true}},"multi":false,"upsert":false},"planSummary":"IXSCAN { vin: 1 }","keysExamined":1,"docsExamined":1,"nMatched":1,"nModified":1,"locks":{"Global":{"acquireCount":{"w":1},"timeAcquiringMicros":{"w":100000}},"Collection":{"acquireCount":{"w":1},"timeAcquiringMicros":{"w":50000}}},"flowControl":{"acquireCount":1,"timeAcquiringMicros":20000},"storage":{"data":{"bytesRead":4096,"timeReadingMicros":300000}},"waitForWriteConcernDurationMillis":400,"durationMillis":1000}}`,
+		`{"t":{"$date":"2020-08-01T10:01:00.000+00:00"},"s":"I","c":"WRITE","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"update","ns":"keyhole.cars","command":{"q":{"vin":"2HG"},"u":{"$set":{"sold":true}},"multi":false,"upsert":false},"planSummary":"IXSCAN { vin: 1 }","keysExamined":1,"docsExamined":1,"nMatched":1,"nModified":1,"durationMillis":1000}}`,
+	}
+	loginfo := NewLogInfo()
+	loginfo.SetSilent(true)
+	if err := loginfo.Parse(bufio.NewReader(strings.NewReader(strings.Join(lines, "\n")))); err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.OpsPatterns) != 1 {
+		t.Fatal("expected 1 query pattern, but got", loginfo.OpsPatterns)
+	}
+	doc := loginfo.OpsPatterns[0]
+	expected := WaitsDoc{BytesRead: 4096, DiskReadMicros: 300000, FlowControlMicros: 20000, LockMicros: 150000,
+		WriteConcernMicros: 400000}
+	if doc.Waits != expected {
+		t.Fatal("expected", expected, "but got", doc.Waits)
+	}
+	if str := getWaitsString(doc); str != "7/15/20/1" {
+		t.Fatal("expected 7/15/20/1, but got", str)
+	}
+
+	str := `2020-05-12T12:48:14.398-0400 I COMMAND [conn6800] command keyhole.cars command: find { find: "cars", filter: { color: "Red" }, $db: "keyhole" } planSummary: COLLSCAN keysExamined:0 docsExamined:11485 numYields:133 nreturned:2 reslen:1234 locks:{ Global: { acquireCount: { r: 268 }, timeAcquiringMicros: { r: 2000 } }, Database: { acquireCount: { r: 134 } } } storage:{ data: { bytesRead: 100, timeReadingMicros: 5000 } } flowControl:{ acquireCount: 1, timeAcquiringMicros: 30 } protocol:op_msg 2352ms`
+	if waits := getTextWaits(str); waits != (WaitsDoc{BytesRead: 100, DiskReadMicros: 5000, FlowControlMicros: 30, LockMicros: 2000}) {
+		t.Fatal("unexpected waits", waits)
+	}
+}
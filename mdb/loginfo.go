@@ -9,13 +9,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
-	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 
@@ -27,52 +29,111 @@ const COLLSCAN = "COLLSCAN"
 
 // LogInfo keeps loginfo struct
 type LogInfo struct {
-	OpsPatterns    []OpPerformanceDoc `bson:"opespatterns"`
-	OutputFilename string
-	SlowOps        []SlowOps `bson:"slowops"`
-	collscan       bool      `bson:"collscan"`
-	filename       string
-	KeyholeInfo    *KeyholeInfo `bson:"keyhole"`
-	mongoInfo      string
-	regex          string
-	silent         bool
-	verbose        bool
+	OpsPatterns        []OpPerformanceDoc `bson:"opespatterns"`
+	OutputFilename     string
+	SlowOps            []SlowOps     `bson:"slowops"`
+	Timeline           []TimelineDoc `bson:"timeline"`
+	churnMap           map[time.Time]ChurnDoc
+	Clients            ClientsDoc `bson:"clients"`
+	clientsMap         map[string]clientInfo
+	collscan           bool `bson:"collscan"`
+	contentHost        string
+	Events             []LogEvent `bson:"events"`
+	existingIndexes    map[string]CollectionIndexes
+	filename           string
+	format             string
+	host               string
+	hostAliases        map[string]string // hosts of file names to hosts of "MongoDB starting"
+	Issues             []IssueDoc        `bson:"issues"`
+	issuesMap          map[string]IssueDoc
+	KeyholeInfo        *KeyholeInfo `bson:"keyhole"`
+	logRegex           *regexp.Regexp
+	mongoInfo          string
+	nsExcludes         []string
+	nsIncludes         []string
+	noSave             bool // parses logs without saving -log.bson.gz, for example to compare
+	numExistingIndexes int
+	PlanFlips          []PlanFlipsDoc `bson:"planflips"`
+	plansMap           map[string]*PlanFlipsDoc
+	recommend          bool
+	Recommendations    []IndexRecommendation `bson:"recommendations"`
+	regex              string
+	showEvents         bool
+	showTimeline       bool
+	silent             bool
+	since              time.Time
+	timelineMap        map[string]TimelineDoc
+	Transactions       TransactionsDoc `bson:"transactions"`
+	txnNamespaces      map[string][]string
+	until              time.Time
+	verbose            bool
+	workers            int
 }
 
 // OpPerformanceDoc stores performance data
 type OpPerformanceDoc struct {
-	Command    string `bson:"command"`    // count, delete, find, remove, and update
-	Count      int    `bson:"count"`      // number of ops
-	Filter     string `bson:"filter"`     // query pattern
-	MaxMilli   int    `bson:"maxmilli"`   // max millisecond
-	Namespace  string `bson:"ns"`         // database.collectin
-	Scan       string `bson:"scan"`       // COLLSCAN
-	TotalMilli int    `bson:"totalmilli"` // total milliseconds
-	Index      string `bson:"index"`      // index used
+	Apps         []AppPerformanceDoc  `json:"apps" bson:"apps"`                 // breakdown by client app
+	Command      string               `json:"command" bson:"command"`           // count, delete, find, remove, and update
+	Count        int                  `json:"count" bson:"count"`               // number of ops
+	DocsExamined int                  `json:"docsexamined" bson:"docsexamined"` // total docs examined
+	Filter       string               `json:"filter" bson:"filter"`             // query pattern
+	Histogram    Histogram            `json:"histogram" bson:"histogram"`       // latency histogram
+	Hosts        []HostPerformanceDoc `json:"hosts" bson:"hosts"`               // breakdown by host
+	KeysExamined int                  `json:"keysexamined" bson:"keysexamined"` // total keys examined
+	MaxMilli     int                  `json:"maxmilli" bson:"maxmilli"`         // max millisecond
+	Namespace    string               `json:"ns" bson:"ns"`                     // database.collectin
+	NumYields    int                  `json:"numyields" bson:"numyields"`       // total yields
+	P50          int                  `json:"p50" bson:"p50"`                   // 50th percentile in milliseconds
+	P95          int                  `json:"p95" bson:"p95"`                   // 95th percentile in milliseconds
+	P99          int                  `json:"p99" bson:"p99"`                   // 99th percentile in milliseconds
+	PlanCacheKey string               `json:"plancachekey" bson:"plancachekey"` // plan cache key
+	QueryHash    string               `json:"queryhash" bson:"queryhash"`       // query hash
+	Reslen       int                  `json:"reslen" bson:"reslen"`             // total response length in bytes
+	Returned     int                  `json:"nreturned" bson:"nreturned"`       // total docs returned
+	Scan         string               `json:"scan" bson:"scan"`                 // COLLSCAN
+	ShapeID      string               `json:"shapeid" bson:"shapeid"`           // fingerprint of command, namespace, and filter
+	TotalMilli   int                  `json:"totalmilli" bson:"totalmilli"`     // total milliseconds
+	Waits        WaitsDoc             `json:"waits" bson:"waits"`               // lock, disk read, write concern, and flow control waits
+	Index        string               `json:"index" bson:"index"`               // index used
 }
 
 // SlowOps holds slow ops log and time
 type SlowOps struct {
-	Milli int
-	Log   string
+	Host  string `json:"host"`
+	Milli int    `json:"milli"`
+	Log   string `json:"log"`
 }
 
 // LogStats log stats structure
 type LogStats struct {
-	filter string
-	index  string
-	milli  int
-	ns     string
-	op     string
-	scan   string
+	app          string // appName
+	conn         string // connection context, for example conn12
+	docsExamined int
+	filter       string
+	index        string
+	keysExamined int
+	milli        int
+	nreturned    int
+	ns           string
+	numYields    int
+	op           string
+	planCacheKey string
+	queryHash    string
+	remote       string // client host:port
+	reslen       int
+	scan         string
+	txn          string // lsid and txnNumber
+	utc          time.Time
+	waits        WaitsDoc
 }
 
 const dollarCmd = "$cmd"
 
 // NewLogInfo -
 func NewLogInfo() *LogInfo {
-	li := LogInfo{collscan: false, silent: false, verbose: false}
+	li := LogInfo{collscan: false, silent: false, verbose: false, workers: runtime.NumCPU()}
 	li.regex = `^\S+ \S+\s+(\w+)\s+\[\w+\] (\w+) (\S+) \S+: (.*) (\d+)ms$` // SERVER-37743
+	li.logRegex = regexp.MustCompile(li.regex)
 	return &li
 }
 
@@ -86,6 +147,11 @@ func (li *LogInfo) SetKeyholeInfo(keyholeInfo *KeyholeInfo) {
 	li.KeyholeInfo = keyholeInfo
 }
 
+// SetTimeline sets to print timeline of slow ops
+func (li *LogInfo) SetTimeline(timeline bool) {
+	li.showTimeline = timeline
+}
+
 // SetSilent -
 func (li *LogInfo) SetSilent(silent bool) {
 	li.silent = silent
@@ -96,10 +162,16 @@ func (li *LogInfo) SetVerbose(verbose bool) {
 	li.verbose = verbose
 }
 
+// SetWorkers sets number of goroutines parsing logs, 1 to parse serially
+func (li *LogInfo) SetWorkers(workers int) {
+	li.workers = workers
+}
+
 // SetRegexPattern sets regex patthen
 func (li *LogInfo) SetRegexPattern(regex string) {
 	if regex != "" {
 		li.regex = regex
+		li.logRegex = regexp.MustCompile(regex)
 	}
 }
 
@@ -152,6 +224,9 @@ func (li *LogInfo) AnalyzeFile(filename string, redact bool) (string, error) {
 			return "", err
 		}
 		li.OutputFilename = ""
+		if li.recommend {
+			li.setRecommendations()
+		}
 	} else if strings.HasSuffix(filename, "-log.enc") == true { // encoded structure is deprecated, replaced with bson.gz
 		log.Println("Using a deprecated file type", filename)
 		var data []byte
@@ -165,169 +240,332 @@ func (li *LogInfo) AnalyzeFile(filename string, redact bool) (string, error) {
 		}
 		li.OutputFilename = ""
 	} else {
-		var file *os.File
-		var reader *bufio.Reader
-		li.filename = filename
-		if file, err = os.Open(filename); err != nil {
+		return li.AnalyzeFiles([]string{filename}, redact)
+	}
+	return li.printLogsSummary(), nil
+}
+
+// AnalyzeFiles analyzes and merges logs from files of one or many hosts
+func (li *LogInfo) AnalyzeFiles(filenames []string, redact bool) (string, error) {
+	var err error
+	if len(filenames) == 0 {
+		return "", errors.New("no log file")
+	}
+	opsMap := map[string]OpPerformanceDoc{}
+	li.SlowOps = []SlowOps{}
+	li.resetStats()
+	for _, filename := range filenames {
+		if err = li.parseFile(filename, opsMap); err != nil {
 			return "", err
 		}
-		defer file.Close()
-		if reader, err = gox.NewReader(file); err != nil {
-			return "", err
+	}
+	li.renameHosts(opsMap)
+	li.setOpsPatterns(opsMap)
+	li.setTimeline()
+	li.setEvents()
+	li.setIssues()
+	li.setClients()
+	li.setPlanFlips()
+	if li.recommend {
+		li.setRecommendations()
+	}
+	if li.noSave == false && (len(li.OpsPatterns) > 0 || len(li.Events) > 0 || len(li.Issues) > 0 ||
+		li.Transactions.Count > 0 || li.Clients.Accepted > 0) {
+		li.OutputFilename = getOutputPrefix(filenames[0])
+		if len(filenames) > 1 {
+			li.OutputFilename += "-merged"
 		}
-		var lineCounts int
-		if li.silent == false {
-			lineCounts, _ = gox.CountLines(reader)
-			file.Seek(0, 0)
+		li.OutputFilename += "-log.bson.gz"
+		if redact == true {
+			li.redactLogs()
 		}
-		if reader, err = gox.NewReader(file); err != nil {
-			return "", err
+		var buf []byte
+		var bsond bson.D
+		if buf, err = bson.Marshal(li); err != nil {
+			return li.printLogsSummary(), err
 		}
-		if err = li.Parse(reader, lineCounts); err != nil {
-			return "", err
+		bson.Unmarshal(buf, &bsond)
+		if buf, err = bson.Marshal(bsond); err != nil {
+			return li.printLogsSummary(), err
 		}
-		if len(li.OpsPatterns) > 0 {
-			li.OutputFilename = filepath.Base(filename)
-			if strings.HasSuffix(li.OutputFilename, ".gz") {
-				li.OutputFilename = li.OutputFilename[:len(li.OutputFilename)-3]
-			}
-			if strings.HasSuffix(li.OutputFilename, ".log") == false {
-				li.OutputFilename += "-log.bson.gz"
-			} else {
-				li.OutputFilename = li.OutputFilename[:len(li.OutputFilename)-4] + "-log.bson.gz"
-			}
-			if redact == true {
-				li.SlowOps = []SlowOps{}
-			}
-			var buf []byte
-			var bsond bson.D
-			if buf, err = bson.Marshal(li); err != nil {
-				return li.printLogsSummary(), err
-			}
-			bson.Unmarshal(buf, &bsond)
-			if buf, err = bson.Marshal(bsond); err != nil {
-				return li.printLogsSummary(), err
-			}
-			gox.OutputGzipped(buf, li.OutputFilename)
-
-			if li.verbose { // encoded structure is deprecated, replaced with bson.gz
-				var data bytes.Buffer
-				enc := gob.NewEncoder(&data)
-				if err = enc.Encode(li); err == nil {
-					filename := li.OutputFilename
-					if idx := strings.LastIndex(filename, "-log.bson.gz"); idx > 0 {
-						filename = filename[:idx] + "-log.enc"
-					}
-					ioutil.WriteFile(filename, data.Bytes(), 0644)
+		gox.OutputGzipped(buf, li.OutputFilename)
+
+		if li.verbose { // encoded structure is deprecated, replaced with bson.gz
+			var data bytes.Buffer
+			enc := gob.NewEncoder(&data)
+			if err = enc.Encode(li); err == nil {
+				filename := li.OutputFilename
+				if idx := strings.LastIndex(filename, "-log.bson.gz"); idx > 0 {
+					filename = filename[:idx] + "-log.enc"
 				}
+				ioutil.WriteFile(filename, data.Bytes(), 0644)
 			}
 		}
 	}
 	return li.printLogsSummary(), nil
 }
 
-// Parse parse text or json
-func (li *LogInfo) Parse(reader *bufio.Reader, counts ...int) error {
+// parseFile parses a log file into the ops map, ops are attributed to the host of the log. Logs are
+// read from stdin if the file name is -, and all logs of an archive are parsed
+func (li *LogInfo) parseFile(filename string, opsMap map[string]OpPerformanceDoc) error {
+	if filename == stdinFilename {
+		return li.parseStdin(opsMap)
+	} else if getArchiveSuffix(filename) != "" {
+		return li.parseArchive(filename, opsMap)
+	}
 	var err error
-	var buf []byte
-	var isPrefix bool
-	var logType string
-	var opsMap map[string]OpPerformanceDoc
-	var stat LogStats
-	opsMap = make(map[string]OpPerformanceDoc)
-	lineCounts := 0
-	if len(counts) > 0 {
-		lineCounts = counts[0]
-	}
-	index := 0
-	for {
-		if lineCounts > 0 && li.silent == false && index%50 == 0 {
-			fmt.Fprintf(os.Stderr, "\r%3d%% ", (100*index)/lineCounts)
-		}
-		if buf, isPrefix, err = reader.ReadLine(); err != nil { // 0x0A separator = newline
-			break
-		}
-		index++
-		str := string(buf)
-		for isPrefix == true {
-			var bbuf []byte
-			if bbuf, isPrefix, err = reader.ReadLine(); err != nil {
-				break
-			}
-			str += string(bbuf)
-		}
-		if logType == "" { //examine the log logType
-			if regexp.MustCompile("^{.*}$").MatchString(str) == true {
-				logType = "logv2"
-				if stat, err = li.ParseLogv2(str); err != nil {
-					continue
-				}
-			} else if regexp.MustCompile("^\\d{4}-\\d{2}-\\d{2}T\\d{2}:\\d{2}:\\d{2}.*").MatchString(str) == true {
-				logType = "text"
-				if stat, err = li.ParseLog(str); err != nil {
-					continue
-				}
-			} else {
-				return errors.New("unsupported format")
-			}
-		} else if logType == "text" {
-			if stat, err = li.ParseLog(str); err != nil {
-				continue
-			}
-		} else if logType == "logv2" {
-			if stat, err = li.ParseLogv2(str); err != nil {
-				continue
-			}
+	var file *os.File
+	var reader *bufio.Reader
+	if file, err = os.Open(filename); err != nil {
+		return err
+	}
+	defer file.Close()
+	if reader, err = gox.NewReader(file); err != nil {
+		return err
+	}
+	var progress func(int) int
+	if fi, err := file.Stat(); err == nil && fi.Size() > 0 {
+		size := fi.Size()
+		progress = func(int) int { // bytes read, compressed or not
+			pos, _ := file.Seek(0, io.SeekCurrent)
+			return int(100 * pos / size)
 		}
-		if stat.op == "" {
-			if li.verbose {
-				fmt.Println(str)
-			}
-			continue
-		} else if stat.op == dollarCmd {
-			continue
+	}
+	return li.parseReader(reader, filename, opsMap, progress)
+}
+
+// parseReader parses logs of a file into the ops map, the host named after the file is mapped to the
+// host found in the log, and renamed after all files are parsed
+func (li *LogInfo) parseReader(reader *bufio.Reader, filename string, opsMap map[string]OpPerformanceDoc,
+	progress func(int) int) error {
+	li.filename = filename
+	li.host = getHostFromFilename(filename)
+	li.contentHost = ""
+	if err := li.parse(reader, opsMap, progress); err != nil {
+		return err
+	}
+	if _, ok := li.hostAliases[li.host]; !ok && li.contentHost != "" && li.contentHost != li.host {
+		li.hostAliases[li.host] = li.contentHost
+	}
+	return nil
+}
+
+// renameHosts replaces hosts named after files with hosts found in logs after all files are parsed,
+// rotated files without a "MongoDB starting" line are of the same host as the file with one
+func (li *LogInfo) renameHosts(opsMap map[string]OpPerformanceDoc) {
+	aliases := resolveHostAliases(li.hostAliases)
+	hosts := make([]string, 0, len(aliases))
+	for from := range aliases {
+		hosts = append(hosts, from)
+	}
+	sort.Strings(hosts)
+	for _, from := range hosts {
+		renameHost(opsMap, li.SlowOps, li.Events, from, aliases[from])
+		li.renamePlansHost(from, aliases[from])
+	}
+}
+
+// resetStats clears stats other than ops patterns before parsing
+func (li *LogInfo) resetStats() {
+	li.churnMap = map[time.Time]ChurnDoc{}
+	li.Clients = ClientsDoc{}
+	li.clientsMap = map[string]clientInfo{}
+	li.Events = []LogEvent{}
+	li.hostAliases = map[string]string{}
+	li.issuesMap = map[string]IssueDoc{}
+	li.plansMap = map[string]*PlanFlipsDoc{}
+	li.timelineMap = map[string]TimelineDoc{}
+	li.Transactions = TransactionsDoc{}
+	li.txnNamespaces = map[string][]string{}
+}
+
+// Parse parse text or json
+func (li *LogInfo) Parse(reader *bufio.Reader, counts ...int) error {
+	opsMap := map[string]OpPerformanceDoc{}
+	li.resetStats()
+	var progress func(int) int
+	if len(counts) > 0 && counts[0] > 0 {
+		progress = func(index int) int { return (100 * index) / counts[0] }
+	}
+	if err := li.parse(reader, opsMap, progress); err != nil {
+		return err
+	}
+	li.setOpsPatterns(opsMap)
+	li.setTimeline()
+	li.setEvents()
+	li.setIssues()
+	li.setClients()
+	li.setPlanFlips()
+	if li.recommend {
+		li.setRecommendations()
+	}
+	return nil
+}
+
+// parse parses text or json logs into the ops map, progress returns percentage of lines read
+func (li *LogInfo) parse(reader *bufio.Reader, opsMap map[string]OpPerformanceDoc, progress func(int) int) error {
+	str, err := readLine(reader)
+	if err != nil {
+		return nil
+	}
+	logType := getLogType(str) //examine the log logType
+	if logType == "" {
+		return errors.New("unsupported format")
+	}
+	if li.workers > 1 {
+		li.parseParallel(reader, opsMap, logType, str, progress)
+	} else {
+		li.parseSerial(reader, opsMap, logType, str, progress)
+	}
+	if li.silent == false {
+		fmt.Fprintf(os.Stderr, "\r%20s\r", "")
+	}
+	return nil
+}
+
+const logTypeLogv2 = "logv2"
+const logTypeText = "text"
+
+var logv2Regex = regexp.MustCompile("^{.*}$")
+var textLogRegex = regexp.MustCompile("^\\d{4}-\\d{2}-\\d{2}T\\d{2}:\\d{2}:\\d{2}.*")
+
+// getLogType returns logv2, text, or empty string if the format is not supported
+func getLogType(str string) string {
+	if logv2Regex.MatchString(str) == true {
+		return logTypeLogv2
+	} else if textLogRegex.MatchString(str) == true {
+		return logTypeText
+	}
+	return ""
+}
+
+// addStat adds a parsed log line to the ops map and keeps top slow ops
+func (li *LogInfo) addStat(opsMap map[string]OpPerformanceDoc, stat LogStats, str string) {
+	if stat.op == "" {
+		if li.verbose {
+			fmt.Println(str)
 		}
-		key := stat.op + "." + stat.ns + "." + stat.filter + "." + stat.scan
-		_, ok := opsMap[key]
-		if stat.op != "insert" && (len(li.SlowOps) < topN || stat.milli > li.SlowOps[topN-1].Milli) {
-			li.SlowOps = append(li.SlowOps, SlowOps{Milli: stat.milli, Log: str})
-			sort.Slice(li.SlowOps, func(i, j int) bool {
-				return li.SlowOps[i].Milli > li.SlowOps[j].Milli
-			})
-			if len(li.SlowOps) > topN {
-				li.SlowOps = li.SlowOps[:topN]
-			}
+		return
+	} else if stat.op == dollarCmd {
+		return
+	}
+	if stat.txn != "" {
+		li.addTxnNamespace(stat.txn, stat.ns)
+	}
+	key := stat.op + "." + stat.ns + "." + stat.filter + "." + stat.scan
+	doc, ok := opsMap[key]
+	if stat.op != "insert" && (len(li.SlowOps) < topN || stat.milli > li.SlowOps[topN-1].Milli) {
+		li.SlowOps = append(li.SlowOps, SlowOps{Host: li.host, Milli: stat.milli, Log: str})
+		sort.Slice(li.SlowOps, func(i, j int) bool {
+			return li.SlowOps[i].Milli > li.SlowOps[j].Milli
+		})
+		if len(li.SlowOps) > topN {
+			li.SlowOps = li.SlowOps[:topN]
 		}
+	}
 
-		if ok {
-			max := opsMap[key].MaxMilli
-			if stat.milli > max {
-				max = stat.milli
-			}
-			x := opsMap[key].TotalMilli + stat.milli
-			y := opsMap[key].Count + 1
-			opsMap[key] = OpPerformanceDoc{Command: opsMap[key].Command, Namespace: stat.ns, Filter: opsMap[key].Filter,
-				MaxMilli: max, TotalMilli: x, Count: y, Scan: stat.scan, Index: stat.index}
-		} else {
-			opsMap[key] = OpPerformanceDoc{Command: stat.op, Namespace: stat.ns, Filter: stat.filter, TotalMilli: stat.milli,
-				MaxMilli: stat.milli, Count: 1, Scan: stat.scan, Index: stat.index}
-		}
+	if !ok {
+		doc = OpPerformanceDoc{Command: stat.op, Namespace: stat.ns, Filter: stat.filter, Histogram: NewHistogram(),
+			ShapeID: getShapeID(stat.op, stat.ns, stat.filter)}
+	}
+	doc.Count++
+	doc.TotalMilli += stat.milli
+	if stat.milli > doc.MaxMilli {
+		doc.MaxMilli = stat.milli
+	}
+	doc.Histogram.Add(stat.milli)
+	doc.DocsExamined += stat.docsExamined
+	doc.KeysExamined += stat.keysExamined
+	doc.NumYields += stat.numYields
+	doc.Reslen += stat.reslen
+	doc.Returned += stat.nreturned
+	doc.Waits.add(stat.waits)
+	if stat.queryHash != "" {
+		doc.QueryHash = stat.queryHash
+		doc.PlanCacheKey = stat.planCacheKey
+	}
+	doc.Scan = stat.scan
+	doc.Index = stat.index
+	if li.host != "" {
+		doc.addHost(li.host, stat.milli)
 	}
+	if client := li.getClient(stat); client != (clientInfo{}) {
+		doc.addApp(client, stat.milli)
+	}
+	opsMap[key] = doc
+	li.addPlan(stat, doc.ShapeID)
+	li.addTimeline(stat)
+}
+
+// getExaminedRatio returns docsExamined/nreturned, docs examined of no returns are divided by 1
+func getExaminedRatio(doc OpPerformanceDoc) string {
+	if doc.DocsExamined == 0 {
+		return "-"
+	}
+	returned := doc.Returned
+	if returned == 0 {
+		returned = 1
+	}
+	ratio := float64(doc.DocsExamined) / float64(returned)
+	if ratio >= 1000000 {
+		return fmt.Sprintf("%.1fM", ratio/1000000)
+	} else if ratio >= 10000 {
+		return fmt.Sprintf("%.1fK", ratio/1000)
+	}
+	return fmt.Sprintf("%.0f", ratio)
+}
+
+// mergeOpPerformanceDoc merges stats of the same query pattern, b is the more recent one
+func mergeOpPerformanceDoc(a OpPerformanceDoc, b OpPerformanceDoc) OpPerformanceDoc {
+	doc := a
+	doc.Count += b.Count
+	doc.TotalMilli += b.TotalMilli
+	if b.MaxMilli > doc.MaxMilli {
+		doc.MaxMilli = b.MaxMilli
+	}
+	doc.Histogram = NewHistogram()
+	doc.Histogram.Merge(a.Histogram)
+	doc.Histogram.Merge(b.Histogram)
+	doc.DocsExamined += b.DocsExamined
+	doc.KeysExamined += b.KeysExamined
+	doc.NumYields += b.NumYields
+	doc.Reslen += b.Reslen
+	doc.Returned += b.Returned
+	doc.Waits.add(b.Waits)
+	if b.QueryHash != "" {
+		doc.QueryHash = b.QueryHash
+		doc.PlanCacheKey = b.PlanCacheKey
+	}
+	doc.Scan = b.Scan
+	doc.Index = b.Index
+	doc.Hosts = mergeHosts(a.Hosts, b.Hosts)
+	doc.Apps = mergeApps(a.Apps, b.Apps)
+	return doc
+}
+
+// setOpsPatterns sets ops patterns from the ops map, sorted by average milliseconds
+func (li *LogInfo) setOpsPatterns(opsMap map[string]OpPerformanceDoc) {
 	li.OpsPatterns = make([]OpPerformanceDoc, 0, len(opsMap))
 	for _, value := range opsMap {
+		value.setPercentiles()
+		apps := value.Apps
+		sort.SliceStable(apps, func(i, j int) bool { return apps[i].TotalMilli > apps[j].TotalMilli })
 		li.OpsPatterns = append(li.OpsPatterns, value)
 	}
 	sort.Slice(li.OpsPatterns, func(i, j int) bool {
 		return float64(li.OpsPatterns[i].TotalMilli)/float64(li.OpsPatterns[i].Count) > float64(li.OpsPatterns[j].TotalMilli)/float64(li.OpsPatterns[j].Count)
 	})
-	if li.silent == false {
-		fmt.Fprintf(os.Stderr, "\r     \r")
-	}
-	return nil
 }
 
 // printLogsSummary prints loginfo summary
 func (li *LogInfo) printLogsSummary() string {
+	if li.format != "" && li.format != FormatTable {
+		str, err := li.formatLogsSummary()
+		if err == nil {
+			return str
+		}
+		log.Println(err)
+	}
 	red := codeRed
 	green := codeGreen
 	tail := codeDefault
@@ -348,9 +586,10 @@ func (li *LogInfo) printLogsSummary() string {
 		summaries = append(summaries, "\n")
 	}
 	var buffer bytes.Buffer
-	buffer.WriteString("\r+----------+--------+------+--------+------+---------------------------------+--------------------------------------------------------------+\n")
-	buffer.WriteString(fmt.Sprintf("| Command  |COLLSCAN|avg ms| max ms | Count| %-32s| %-60s |\n", "Namespace", "Query Pattern"))
-	buffer.WriteString("|----------+--------+------+--------+------+---------------------------------+--------------------------------------------------------------|\n")
+	buffer.WriteString("\r+----------+--------+------+------+------+------+--------+------+--------+---------------+---------------------------------+--------------------------------------------------------------+\n")
+	buffer.WriteString(fmt.Sprintf("| Command  |COLLSCAN|avg ms|p50 ms|p95 ms|p99 ms| max ms | Count|docs/ret|lock/disk/wc/fc| %-32s| %-60s |\n", "Namespace", "Query Pattern"))
+	buffer.WriteString("|----------+--------+------+------+------+------+--------+------+--------+---------------+---------------------------------+--------------------------------------------------------------|\n")
+	numHosts := getNumberHosts(li.OpsPatterns)
 	for _, value := range li.OpsPatterns {
 		str := value.Filter
 		if len(value.Command) > 10 {
@@ -370,12 +609,17 @@ func (li *LogInfo) printLogsSummary() string {
 		output := ""
 		avg := float64(value.TotalMilli) / float64(value.Count)
 		avgstr := gox.MilliToTimeString(avg)
+		p50 := percentileString(value, value.P50)
+		p95 := percentileString(value, value.P95)
+		p99 := percentileString(value, value.P99)
+		ratio := getExaminedRatio(value)
+		waits := getWaitsString(value)
 		if value.Scan == COLLSCAN {
-			output = fmt.Sprintf("|%-10s %v%8s%v %6s %8d %6d %-33s %v%-62s%v|\n", value.Command, red, value.Scan, tail,
-				avgstr, value.MaxMilli, value.Count, value.Namespace, red, str, tail)
+			output = fmt.Sprintf("|%-10s %v%8s%v %6s %6s %6s %6s %8d %6d %8s %15s %-33s %v%-62s%v|\n", value.Command, red, value.Scan,
+				tail, avgstr, p50, p95, p99, value.MaxMilli, value.Count, ratio, waits, value.Namespace, red, str, tail)
 		} else {
-			output = fmt.Sprintf("|%-10s %8s %6s %8d %6d %-33s %-62s|\n", value.Command, value.Scan,
-				avgstr, value.MaxMilli, value.Count, value.Namespace, str)
+			output = fmt.Sprintf("|%-10s %8s %6s %6s %6s %6s %8d %6d %8s %15s %-33s %-62s|\n", value.Command, value.Scan,
+				avgstr, p50, p95, p99, value.MaxMilli, value.Count, ratio, waits, value.Namespace, str)
 		}
 		buffer.WriteString(output)
 		if len(value.Filter) > 60 {
@@ -398,21 +642,54 @@ func (li *LogInfo) printLogsSummary() string {
 					}
 				}
 				if value.Scan == COLLSCAN {
-					output = fmt.Sprintf("|%74s   %v%-62s%v|\n", " ", red, pstr, tail)
+					output = fmt.Sprintf("|%120s   %v%-62s%v|\n", " ", red, pstr, tail)
 					buffer.WriteString(output)
 				} else {
-					output = fmt.Sprintf("|%74s   %-62s|\n", " ", pstr)
+					output = fmt.Sprintf("|%120s   %-62s|\n", " ", pstr)
 					buffer.WriteString(output)
 				}
 			}
 		}
 		if value.Index != "" {
-			output = fmt.Sprintf("|...index:  %v%-128s%v|\n", green, value.Index, tail)
+			output = fmt.Sprintf("|...index:  %v%-174s%v|\n", green, value.Index, tail)
 			buffer.WriteString(output)
 		}
+		if numHosts > 1 {
+			for _, h := range value.Hosts {
+				hstr := fmt.Sprintf("%v, avg ms: %v, max ms: %d, count: %d", h.Host,
+					gox.MilliToTimeString(float64(h.TotalMilli)/float64(h.Count)), h.MaxMilli, h.Count)
+				buffer.WriteString(fmt.Sprintf("|...host:   %-174s|\n", hstr))
+			}
+		}
+		for _, a := range getTopApps(value.Apps) {
+			astr := fmt.Sprintf("%v, avg ms: %v, max ms: %d, count: %d", getAppString(a),
+				gox.MilliToTimeString(float64(a.TotalMilli)/float64(a.Count)), a.MaxMilli, a.Count)
+			buffer.WriteString(fmt.Sprintf("|...app:    %-174s|\n", astr))
+		}
 	}
-	buffer.WriteString("+----------+--------+------+--------+------+---------------------------------+--------------------------------------------------------------+\n")
+	buffer.WriteString("+----------+--------+------+------+------+------+--------+------+--------+---------------+---------------------------------+--------------------------------------------------------------+\n")
 	summaries = append(summaries, buffer.String())
+	if li.showTimeline && len(li.Timeline) > 0 {
+		summaries = append(summaries, li.printTimeline())
+	}
+	if li.showEvents && len(li.Events) > 0 {
+		summaries = append(summaries, li.printEvents())
+	}
+	if len(li.PlanFlips) > 0 {
+		summaries = append(summaries, li.printPlanFlips())
+	}
+	if li.recommend {
+		summaries = append(summaries, li.printRecommendations())
+	}
+	if li.Transactions.Count > 0 {
+		summaries = append(summaries, li.printTransactions())
+	}
+	if li.Clients.Accepted > 0 || len(li.Clients.Drivers) > 0 {
+		summaries = append(summaries, li.printClients())
+	}
+	if len(li.Issues) > 0 {
+		summaries = append(summaries, li.printIssues())
+	}
 	if li.KeyholeInfo != nil {
 		summaries = append(summaries, li.KeyholeInfo.Print())
 	}
@@ -0,0 +1,228 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// query pattern changes
+const (
+	diffChanged       = "changed"
+	diffCollscanFixed = "COLLSCAN fixed"
+	diffCollscanNew   = "COLLSCAN new"
+)
+
+// PatternDiff stores a query pattern before and after
+type PatternDiff struct {
+	After  OpPerformanceDoc
+	Before OpPerformanceDoc
+	Status string
+}
+
+// LogInfoDiff compares query patterns of two loginfo reports
+type LogInfoDiff struct {
+	Changed []PatternDiff
+	Gone    []OpPerformanceDoc
+	New     []OpPerformanceDoc
+
+	silent    bool
+	threshold float64
+	verbose   bool
+}
+
+// NewLogInfoDiff returns LogInfoDiff, threshold is percent change of avg, max, or count to report
+func NewLogInfoDiff(threshold float64) *LogInfoDiff {
+	return &LogInfoDiff{threshold: threshold}
+}
+
+// SetSilent -
+func (d *LogInfoDiff) SetSilent(silent bool) {
+	d.silent = silent
+}
+
+// SetVerbose -
+func (d *LogInfoDiff) SetVerbose(verbose bool) {
+	d.verbose = verbose
+}
+
+// DiffFiles compares two loginfo reports, saved -log.bson.gz files or logs. Logs are parsed without
+// saving, logs of the same name, e.g. mongod.log, would overwrite each other's -log.bson.gz
+func (d *LogInfoDiff) DiffFiles(before string, after string) (string, error) {
+	var err error
+	lis := []*LogInfo{}
+	for _, filename := range []string{before, after} {
+		li := NewLogInfo()
+		li.SetSilent(d.silent)
+		li.SetVerbose(d.verbose)
+		li.noSave = true
+		if _, err = li.AnalyzeFile(filename, false); err != nil {
+			return "", err
+		}
+		lis = append(lis, li)
+	}
+	d.Compare(lis[0].OpsPatterns, lis[1].OpsPatterns)
+	str := fmt.Sprintf("before: %v\nafter:  %v\n", before, after)
+	for i, filename := range []string{before, after} {
+		if n := countLegacyPatterns(lis[i].OpsPatterns); n > 0 {
+			str += fmt.Sprintf("warning: %v was saved before canonical query shapes, %d patterns show as gone or new, analyze its logs again\n",
+				filename, n)
+		}
+	}
+	return str + d.Print(), nil
+}
+
+// countLegacyPatterns returns the number of query patterns without a shape ID, of a report saved before
+// canonical query shapes, their filters never match filters of logs parsed since
+func countLegacyPatterns(patterns []OpPerformanceDoc) int {
+	n := 0
+	for _, doc := range patterns {
+		if doc.ShapeID == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Compare matches query patterns by command, namespace, and filter
+func (d *LogInfoDiff) Compare(before []OpPerformanceDoc, after []OpPerformanceDoc) {
+	d.Changed = []PatternDiff{}
+	d.Gone = []OpPerformanceDoc{}
+	d.New = []OpPerformanceDoc{}
+	beforeMap := getPatternsMap(before)
+	afterMap := getPatternsMap(after)
+	for key, b := range beforeMap {
+		a, ok := afterMap[key]
+		if !ok {
+			d.Gone = append(d.Gone, b)
+			continue
+		}
+		status := ""
+		if b.Scan == COLLSCAN && a.Scan != COLLSCAN {
+			status = diffCollscanFixed
+		} else if b.Scan != COLLSCAN && a.Scan == COLLSCAN {
+			status = diffCollscanNew
+		} else if math.Abs(getPercentChange(getAvgMilli(b), getAvgMilli(a))) >= d.threshold ||
+			math.Abs(getPercentChange(float64(b.MaxMilli), float64(a.MaxMilli))) >= d.threshold ||
+			math.Abs(getPercentChange(float64(b.Count), float64(a.Count))) >= d.threshold {
+			status = diffChanged
+		}
+		if status != "" {
+			d.Changed = append(d.Changed, PatternDiff{After: a, Before: b, Status: status})
+		}
+	}
+	for key, a := range afterMap {
+		if _, ok := beforeMap[key]; !ok {
+			d.New = append(d.New, a)
+		}
+	}
+	sort.Slice(d.Changed, func(i, j int) bool {
+		x := getAvgMilli(d.Changed[i].After) - getAvgMilli(d.Changed[i].Before)
+		y := getAvgMilli(d.Changed[j].After) - getAvgMilli(d.Changed[j].Before)
+		return math.Abs(x) > math.Abs(y)
+	})
+	for _, docs := range [][]OpPerformanceDoc{d.Gone, d.New} {
+		sort.Slice(docs, func(i, j int) bool { return docs[i].TotalMilli > docs[j].TotalMilli })
+	}
+}
+
+// Print returns new, gone, and changed query patterns
+func (d *LogInfoDiff) Print() string {
+	red := codeRed
+	green := codeGreen
+	tail := codeDefault
+	if d.silent == true {
+		red = ""
+		green = ""
+		tail = ""
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("New query patterns (%d):\n", len(d.New)))
+	for _, doc := range d.New {
+		font, end := "", ""
+		if doc.Scan == COLLSCAN {
+			font, end = red, tail
+		}
+		buffer.WriteString(fmt.Sprintf("  %v%-8s %-8s avg %s, max %dms, count %d, %v %v%v\n", font, doc.Scan, doc.Command,
+			formatAvgMilli(doc), doc.MaxMilli, doc.Count, doc.Namespace, doc.Filter, end))
+	}
+	buffer.WriteString(fmt.Sprintf("\nGone query patterns (%d):\n", len(d.Gone)))
+	for _, doc := range d.Gone {
+		font, end := "", ""
+		if doc.Scan == COLLSCAN {
+			font, end = green, tail
+		}
+		buffer.WriteString(fmt.Sprintf("  %v%-8s %-8s avg %s, max %dms, count %d, %v %v%v\n", font, doc.Scan, doc.Command,
+			formatAvgMilli(doc), doc.MaxMilli, doc.Count, doc.Namespace, doc.Filter, end))
+	}
+	buffer.WriteString(fmt.Sprintf("\nChanged query patterns (%d), threshold %v%%:\n", len(d.Changed), d.threshold))
+	for _, diff := range d.Changed {
+		b, a := diff.Before, diff.After
+		font := green
+		if diff.Status == diffCollscanNew || (diff.Status == diffChanged && getAvgMilli(a) > getAvgMilli(b)) {
+			font = red
+		}
+		buffer.WriteString(fmt.Sprintf("  %v%-14s%v %-8s %v %v\n", font, diff.Status, tail, a.Command, a.Namespace, a.Filter))
+		buffer.WriteString(fmt.Sprintf("      avg %s -> %s (%s), max %dms -> %dms (%s), count %d -> %d (%s)\n",
+			formatAvgMilli(b), formatAvgMilli(a), formatPercentChange(getAvgMilli(b), getAvgMilli(a)),
+			b.MaxMilli, a.MaxMilli, formatPercentChange(float64(b.MaxMilli), float64(a.MaxMilli)),
+			b.Count, a.Count, formatPercentChange(float64(b.Count), float64(a.Count))))
+		if b.Index != a.Index {
+			buffer.WriteString(fmt.Sprintf("      index %v -> %v\n", b.Index, a.Index))
+		}
+	}
+	return buffer.String()
+}
+
+// getPatternsMap returns query patterns keyed by command, namespace, and filter,
+// patterns of different plans are merged and flagged COLLSCAN if any was
+func getPatternsMap(docs []OpPerformanceDoc) map[string]OpPerformanceDoc {
+	patterns := map[string]OpPerformanceDoc{}
+	for _, doc := range docs {
+		key := doc.Command + "." + doc.Namespace + "." + doc.Filter
+		if value, ok := patterns[key]; ok {
+			scan := value.Scan
+			value = mergeOpPerformanceDoc(value, doc)
+			if scan == COLLSCAN {
+				value.Scan = COLLSCAN
+			}
+			patterns[key] = value
+		} else {
+			patterns[key] = doc
+		}
+	}
+	return patterns
+}
+
+func getAvgMilli(doc OpPerformanceDoc) float64 {
+	if doc.Count == 0 {
+		return 0
+	}
+	return float64(doc.TotalMilli) / float64(doc.Count)
+}
+
+func formatAvgMilli(doc OpPerformanceDoc) string {
+	return fmt.Sprintf("%.0fms", getAvgMilli(doc))
+}
+
+// getPercentChange returns percent change from before to after
+func getPercentChange(before float64, after float64) float64 {
+	if before == 0 {
+		if after == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return (after - before) * 100 / before
+}
+
+func formatPercentChange(before float64, after float64) string {
+	pct := getPercentChange(before, after)
+	if math.IsInf(pct, 1) {
+		return "new"
+	}
+	return fmt.Sprintf("%+.0f%%", pct)
+}
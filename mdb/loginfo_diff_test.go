@@ -0,0 +1,93 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/simagix/gox"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestLogInfoDiffCompare(t *testing.T) {
+	before := []OpPerformanceDoc{
+		{Command: "find", Namespace: "db.a", Filter: "{ a: 1 }", Scan: COLLSCAN, Count: 10, TotalMilli: 5000, MaxMilli: 900},
+		{Command: "find", Namespace: "db.b", Filter: "{ b: 1 }", Count: 10, TotalMilli: 1000, MaxMilli: 200},
+		{Command: "find", Namespace: "db.c", Filter: "{ c: 1 }", Count: 10, TotalMilli: 1000, MaxMilli: 200},
+		{Command: "remove", Namespace: "db.d", Filter: "{ d: 1 }", Count: 1, TotalMilli: 100, MaxMilli: 100},
+	}
+	after := []OpPerformanceDoc{
+		{Command: "find", Namespace: "db.a", Filter: "{ a: 1 }", Count: 10, TotalMilli: 1000, MaxMilli: 200},
+		{Command: "find", Namespace: "db.b", Filter: "{ b: 1 }", Count: 11, TotalMilli: 1100, MaxMilli: 210},
+		{Command: "find", Namespace: "db.c", Filter: "{ c: 1 }", Count: 10, TotalMilli: 3000, MaxMilli: 600},
+		{Command: "find", Namespace: "db.c", Filter: "{ c: 1 }", Scan: COLLSCAN, Count: 1, TotalMilli: 900, MaxMilli: 900},
+		{Command: "update", Namespace: "db.e", Filter: "{ e: 1 }", Count: 1, TotalMilli: 100, MaxMilli: 100},
+	}
+	d := NewLogInfoDiff(20)
+	d.Compare(before, after)
+	if len(d.New) != 1 || d.New[0].Namespace != "db.e" {
+		t.Fatal("expected new pattern db.e, but got", d.New)
+	}
+	if len(d.Gone) != 1 || d.Gone[0].Namespace != "db.d" {
+		t.Fatal("expected gone pattern db.d, but got", d.Gone)
+	}
+	status := map[string]string{}
+	for _, diff := range d.Changed {
+		status[diff.After.Namespace] = diff.Status
+	}
+	if len(status) != 2 || status["db.a"] != diffCollscanFixed || status["db.c"] != diffCollscanNew {
+		t.Fatal("unexpected changed patterns", status)
+	}
+}
+
+func TestLogInfoDiffFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyhole")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pwd, _ := os.Getwd()
+	defer os.Chdir(pwd)
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	logs := map[string]string{
+		"before/mongod.log": `{"t":{"$date":"2020-05-12T16:59:00.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"Blue"},"$db":"keyhole"},"planSummary":"COLLSCAN","durationMillis":820}}`,
+		"after/mongod.log":  `{"t":{"$date":"2020-05-13T16:59:00.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"Blue"},"$db":"keyhole"},"planSummary":"IXSCAN { color: 1 }","durationMillis":120}}`,
+	}
+	for filename, str := range logs {
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		if err = ioutil.WriteFile(filename, []byte(str+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := NewLogInfoDiff(20)
+	d.SetSilent(true)
+	if _, err = d.DiffFiles("before/mongod.log", "after/mongod.log"); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Changed) != 1 || d.Changed[0].Status != diffCollscanFixed {
+		t.Fatal("expected COLLSCAN fixed, but got", d.Changed)
+	}
+	if _, err = os.Stat("mongod-log.bson.gz"); err == nil {
+		t.Fatal("expected logs compared without saving mongod-log.bson.gz")
+	}
+
+	legacy := NewLogInfo() // saved before canonical query shapes
+	legacy.OpsPatterns = []OpPerformanceDoc{{Command: "find", Namespace: "keyhole.cars", Filter: "{ color: 1 }",
+		Scan: COLLSCAN, Count: 1, TotalMilli: 820, MaxMilli: 820}}
+	data, _ := bson.Marshal(legacy)
+	gox.OutputGzipped(data, "before-log.bson.gz")
+	str, err := d.DiffFiles("before-log.bson.gz", "after/mongod.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(str, "warning: before-log.bson.gz was saved before canonical query shapes, 1 patterns") == false ||
+		strings.Contains(str, "warning: after/mongod.log") == true {
+		t.Fatal("expected a warning of the legacy report, but got", str)
+	}
+}
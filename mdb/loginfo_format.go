@@ -0,0 +1,269 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+)
+
+// loginfo output formats
+const (
+	FormatCSV      = "csv"
+	FormatHTML     = "html"
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+	FormatTable    = "table"
+)
+
+// SetFormat sets output format, table, json, csv, markdown, or html
+func (li *LogInfo) SetFormat(format string) error {
+	format = strings.ToLower(format)
+	if format == "md" {
+		format = FormatMarkdown
+	}
+	switch format {
+	case "", FormatTable, FormatCSV, FormatHTML, FormatJSON, FormatMarkdown:
+		li.format = format
+		return nil
+	}
+	return fmt.Errorf("unsupported format %v, use table, json, csv, markdown, or html", format)
+}
+
+// formatLogsSummary returns ops patterns and slow ops in the output format
+func (li *LogInfo) formatLogsSummary() (string, error) {
+	switch li.format {
+	case FormatCSV:
+		return li.getLogsSummaryCSV()
+	case FormatHTML:
+		return li.getLogsSummaryHTML()
+	case FormatJSON:
+		return li.getLogsSummaryJSON()
+	case FormatMarkdown:
+		return li.getLogsSummaryMarkdown(), nil
+	}
+	return "", fmt.Errorf("unsupported format %v", li.format)
+}
+
+var opsPatternsHeader = []string{"command", "scan", "avg_ms", "p50_ms", "p95_ms", "p99_ms", "max_ms", "count",
+	"keys_examined", "docs_examined", "nreturned", "docs_per_returned", "namespace", "filter", "index",
+	"shape_id", "lock_ms", "disk_read_ms", "write_concern_ms", "flow_control_ms"}
+
+// getOpsPatternRow returns values of a query pattern in the order of opsPatternsHeader
+func getOpsPatternRow(doc OpPerformanceDoc) []string {
+	avg := 0
+	if doc.Count > 0 {
+		avg = doc.TotalMilli / doc.Count
+	}
+	ratio := ""
+	if doc.DocsExamined > 0 {
+		returned := doc.Returned
+		if returned == 0 {
+			returned = 1
+		}
+		ratio = strconv.FormatFloat(float64(doc.DocsExamined)/float64(returned), 'f', 1, 64)
+	}
+	return []string{doc.Command, doc.Scan, strconv.Itoa(avg), getPercentileCell(doc, doc.P50),
+		getPercentileCell(doc, doc.P95), getPercentileCell(doc, doc.P99), strconv.Itoa(doc.MaxMilli), strconv.Itoa(doc.Count), strconv.Itoa(doc.KeysExamined),
+		strconv.Itoa(doc.DocsExamined), strconv.Itoa(doc.Returned), ratio, doc.Namespace,
+		doc.Filter, doc.Index, doc.ShapeID, strconv.Itoa(doc.Waits.LockMicros / 1000),
+		strconv.Itoa(doc.Waits.DiskReadMicros / 1000), strconv.Itoa(doc.Waits.WriteConcernMicros / 1000),
+		strconv.Itoa(doc.Waits.FlowControlMicros / 1000)}
+}
+
+// getPercentileCell returns a percentile in milliseconds, or - of a report saved before histograms
+func getPercentileCell(doc OpPerformanceDoc, milli int) string {
+	if len(doc.Histogram) == 0 {
+		return "-"
+	}
+	return strconv.Itoa(milli)
+}
+
+// MarshalJSON returns percentiles as null of a report saved before histograms, not 0 milliseconds
+func (doc OpPerformanceDoc) MarshalJSON() ([]byte, error) {
+	type opPerformanceDoc OpPerformanceDoc
+	percentile := func(milli int) *int {
+		if len(doc.Histogram) == 0 {
+			return nil
+		}
+		return &milli
+	}
+	return json.Marshal(struct {
+		opPerformanceDoc
+		P50 *int `json:"p50"`
+		P95 *int `json:"p95"`
+		P99 *int `json:"p99"`
+	}{opPerformanceDoc(doc), percentile(doc.P50), percentile(doc.P95), percentile(doc.P99)})
+}
+
+// htmlCell is a value of a query pattern and its CSS class
+type htmlCell struct {
+	Class string
+	Value string
+}
+
+// getOpsPatternClass returns the CSS class of a value by its column of opsPatternsHeader
+func getOpsPatternClass(header string, value string) string {
+	switch header {
+	case "scan":
+		return value
+	case "filter", "index", "shape_id":
+		return "code"
+	}
+	return ""
+}
+
+// getLogsSummaryJSON returns ops patterns and slow ops in JSON
+func (li *LogInfo) getLogsSummaryJSON() (string, error) {
+	doc := map[string]interface{}{"keyhole": li.KeyholeInfo, "opsPatterns": li.OpsPatterns, "slowOps": li.SlowOps}
+	if len(li.Events) > 0 {
+		doc["events"] = li.Events
+	}
+	if len(li.Issues) > 0 {
+		doc["issues"] = li.Issues
+	}
+	if len(li.PlanFlips) > 0 {
+		doc["planFlips"] = li.PlanFlips
+	}
+	if li.recommend {
+		doc["recommendations"] = li.Recommendations
+	}
+	if li.Transactions.Count > 0 {
+		doc["transactions"] = li.Transactions
+	}
+	if li.Clients.Accepted > 0 || len(li.Clients.Drivers) > 0 {
+		doc["clients"] = li.Clients
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	return string(data), err
+}
+
+// getLogsSummaryCSV returns ops patterns, followed by slow ops, in CSV
+func (li *LogInfo) getLogsSummaryCSV() (string, error) {
+	var buffer bytes.Buffer
+	w := csv.NewWriter(&buffer)
+	w.Write(opsPatternsHeader)
+	for _, doc := range li.OpsPatterns {
+		w.Write(getOpsPatternRow(doc))
+	}
+	if len(li.SlowOps) > 0 {
+		w.Write([]string{})
+		w.Write([]string{"milli", "host", "log"})
+		for _, op := range li.SlowOps {
+			w.Write([]string{strconv.Itoa(op.Milli), op.Host, op.Log})
+		}
+	}
+	w.Flush()
+	return buffer.String(), w.Error()
+}
+
+// getLogsSummaryMarkdown returns ops patterns and slow ops in GitHub markdown
+func (li *LogInfo) getLogsSummaryMarkdown() string {
+	escape := func(s string) string {
+		return strings.ReplaceAll(strings.ReplaceAll(s, "|", "\\|"), "\n", " ")
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString("## Query Patterns\n\n")
+	buffer.WriteString("| " + strings.Join(opsPatternsHeader, " | ") + " |\n")
+	buffer.WriteString("|" + strings.Repeat(" --- |", len(opsPatternsHeader)) + "\n")
+	for _, doc := range li.OpsPatterns {
+		row := getOpsPatternRow(doc)
+		for i, v := range row {
+			if v != "" && (opsPatternsHeader[i] == "filter" || opsPatternsHeader[i] == "index") {
+				row[i] = "`" + escape(v) + "`"
+			} else {
+				row[i] = escape(v)
+			}
+		}
+		buffer.WriteString("| " + strings.Join(row, " | ") + " |\n")
+	}
+	if len(li.SlowOps) > 0 {
+		buffer.WriteString(fmt.Sprintf("\n## Top %d Slow Ops\n\n", len(li.SlowOps)))
+		for _, op := range li.SlowOps {
+			buffer.WriteString(fmt.Sprintf("- %dms %v\n  ```\n  %v\n  ```\n", op.Milli, op.Host, op.Log))
+		}
+	}
+	if li.KeyholeInfo != nil {
+		buffer.WriteString("\n```\n" + li.KeyholeInfo.Print() + "\n```\n")
+	}
+	return buffer.String()
+}
+
+// getLogsSummaryHTML returns a standalone HTML page with sortable tables
+func (li *LogInfo) getLogsSummaryHTML() (string, error) {
+	rows := [][]htmlCell{}
+	for _, doc := range li.OpsPatterns {
+		row := []htmlCell{}
+		for i, v := range getOpsPatternRow(doc) {
+			row = append(row, htmlCell{Class: getOpsPatternClass(opsPatternsHeader[i], v), Value: v})
+		}
+		rows = append(rows, row)
+	}
+	keyholeInfo := ""
+	if li.KeyholeInfo != nil {
+		keyholeInfo = li.KeyholeInfo.Print()
+	}
+	data := map[string]interface{}{"Header": opsPatternsHeader, "Rows": rows, "SlowOps": li.SlowOps,
+		"Title": "Keyhole Log Analytics", "KeyholeInfo": keyholeInfo}
+	var buffer bytes.Buffer
+	tmpl, err := template.New("loginfo").Parse(loginfoHTMLTemplate)
+	if err != nil {
+		return "", err
+	}
+	err = tmpl.Execute(&buffer, data)
+	return buffer.String(), err
+}
+
+const loginfoHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+  body { font-family: Arial, Helvetica, sans-serif; font-size: 13px; }
+  table { border-collapse: collapse; margin-bottom: 20px; }
+  th, td { border: 1px solid #ccc; padding: 4px 6px; vertical-align: top; }
+  th { background-color: #3b5e8c; color: #fff; cursor: pointer; }
+  tr:nth-child(even) { background-color: #f2f2f2; }
+  td.code { font-family: monospace; word-break: break-all; }
+  .COLLSCAN { color: #c00; font-weight: bold; }
+</style>
+</head>
+<body>
+<h2>{{.Title}}</h2>
+<table class="sortable">
+<tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td class="{{.Class}}">{{.Value}}</td>{{end}}</tr>
+{{end}}</table>
+{{if .SlowOps}}<h3>Slow Ops</h3>
+<table class="sortable">
+<tr><th>milli</th><th>host</th><th>log</th></tr>
+{{range .SlowOps}}<tr><td>{{.Milli}}</td><td>{{.Host}}</td><td class="code">{{.Log}}</td></tr>
+{{end}}</table>{{end}}
+<pre>{{.KeyholeInfo}}</pre>
+<script>
+document.querySelectorAll("table.sortable").forEach(function(table) {
+  table.querySelectorAll("th").forEach(function(th, col) {
+    th.addEventListener("click", function() {
+      var rows = Array.prototype.slice.call(table.rows, 1);
+      var asc = th.getAttribute("data-order") !== "asc";
+      rows.sort(function(a, b) {
+        var x = a.cells[col].textContent, y = b.cells[col].textContent;
+        var nx = parseFloat(x), ny = parseFloat(y);
+        var c = (!isNaN(nx) && !isNaN(ny)) ? nx - ny : x.localeCompare(y);
+        return asc ? c : -c;
+      });
+      th.setAttribute("data-order", asc ? "asc" : "desc");
+      rows.forEach(function(row) { table.tBodies[0].appendChild(row); });
+    });
+  });
+});
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,61 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetFormat(t *testing.T) {
+	li := NewLogInfo()
+	if err := li.SetFormat("MD"); err != nil || li.format != FormatMarkdown {
+		t.Fatal("expected markdown, but got", li.format, err)
+	}
+	if err := li.SetFormat("xml"); err == nil {
+		t.Fatal("expected error for unsupported format")
+	}
+}
+
+func TestFormatLogsSummary(t *testing.T) {
+	li := NewLogInfo()
+	li.OpsPatterns = []OpPerformanceDoc{{Command: "find", Count: 2, DocsExamined: 300, Filter: `{ a: 1, b: "|" }`,
+		MaxMilli: 200, Namespace: "db.coll", Returned: 2, Scan: COLLSCAN, TotalMilli: 300}}
+	li.SlowOps = []SlowOps{{Milli: 200, Log: "slow op"}}
+	for _, format := range []string{FormatCSV, FormatHTML, FormatJSON, FormatMarkdown} {
+		li.SetFormat(format)
+		str, err := li.formatLogsSummary()
+		if err != nil {
+			t.Fatal(format, err)
+		}
+		if strings.Contains(str, "db.coll") == false || strings.Contains(str, "slow op") == false {
+			t.Fatal(format, "missing values", str)
+		}
+	}
+	li.SetFormat(FormatCSV)
+	str, _ := li.formatLogsSummary()
+	if strings.Contains(str, "find,COLLSCAN,150,-,-,-,200,") == false || strings.Contains(str, ",150.0,db.coll,") == false {
+		t.Fatal("unexpected csv", str)
+	}
+	li.SetFormat(FormatJSON)
+	if str, _ = li.formatLogsSummary(); strings.Contains(str, `"p50": null`) == false {
+		t.Fatal("expected null percentiles of no histogram, but got", str)
+	}
+	li.OpsPatterns[0].Histogram = NewHistogram()
+	li.OpsPatterns[0].P50, li.OpsPatterns[0].P95, li.OpsPatterns[0].P99 = 100, 200, 200
+	if str, _ = li.formatLogsSummary(); strings.Contains(str, `"p50": 100`) == false ||
+		strings.Contains(str, `"command": "find"`) == false {
+		t.Fatal("expected percentiles, but got", str)
+	}
+	li.SetFormat(FormatCSV)
+	if str, _ = li.formatLogsSummary(); strings.Contains(str, "find,COLLSCAN,150,100,200,200,200,") == false {
+		t.Fatal("unexpected csv", str)
+	}
+	li.SetFormat(FormatHTML)
+	str, _ = li.formatLogsSummary()
+	if strings.Contains(str, `<td class="COLLSCAN">COLLSCAN</td>`) == false ||
+		strings.Contains(str, `<td class="code">{ a: 1, b: &#34;|&#34; }</td>`) == false ||
+		strings.Contains(str, `<td class="code">0</td>`) == true {
+		t.Fatal("unexpected html", str)
+	}
+}
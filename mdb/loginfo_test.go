@@ -4,9 +4,13 @@ package mdb
 
 import (
 	"bufio"
+	"fmt"
 	"os"
+	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestLogInfo(t *testing.T) {
@@ -28,3 +32,268 @@ func TestLoginfoParse(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestLogInfoTimeline(t *testing.T) {
+	lines := []string{
+		`2020-05-12T12:48:14.398-0400 I COMMAND [conn1] command keyhole.cars command: find { find: "cars", filter: { color: "Red" }, $db: "keyhole" } planSummary: COLLSCAN keysExamined:0 docsExamined:100 numYields:0 nreturned:1 reslen:100 protocol:op_msg 120ms`,
+		`2020-05-12T12:48:44.398-0400 I COMMAND [conn1] command keyhole.cars command: find { find: "cars", filter: { color: "Blue" }, $db: "keyhole" } planSummary: COLLSCAN keysExamined:0 docsExamined:100 numYields:0 nreturned:1 reslen:100 protocol:op_msg 130ms`,
+		`2020-05-12T12:50:14.398-0400 I COMMAND [conn1] command keyhole.cars command: find { find: "cars", filter: { color: "Red" }, $db: "keyhole" } planSummary: IXSCAN { color: 1 } keysExamined:1 docsExamined:1 numYields:0 nreturned:1 reslen:100 protocol:op_msg 110ms`,
+	}
+	loginfo := NewLogInfo()
+	loginfo.SetSilent(true)
+	rd := bufio.NewReader(strings.NewReader(strings.Join(lines, "\n")))
+	if err := loginfo.Parse(rd); err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.Timeline) != 2 {
+		t.Fatal("expected 2 minutes, but got", len(loginfo.Timeline))
+	}
+	if doc := loginfo.Timeline[0]; doc.Count != 2 || doc.TotalMilli != 250 || doc.Collscan != 2 {
+		t.Fatal("unexpected timeline", doc)
+	}
+	t.Log(loginfo.printTimeline())
+}
+
+func TestLogInfoExamined(t *testing.T) {
+	str := `{"t":{"$date":"2020-08-01T10:02:00.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"Blue"},"$db":"keyhole"},"planSummary":"COLLSCAN","keysExamined":0,"docsExamined":10000,"cursorExhausted":true,"numYields":10,"nreturned":4,"queryHash":"ABCD1234","planCacheKey":"EF567890","reslen":1234,"protocol":"op_msg","durationMillis":820}}`
+	loginfo := NewLogInfo()
+	loginfo.SetSilent(true)
+	rd := bufio.NewReader(strings.NewReader(str))
+	if err := loginfo.Parse(rd); err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.OpsPatterns) != 1 {
+		t.Fatal("expected 1 pattern, but got", len(loginfo.OpsPatterns))
+	}
+	doc := loginfo.OpsPatterns[0]
+	if doc.DocsExamined != 10000 || doc.Returned != 4 || doc.QueryHash != "ABCD1234" || doc.NumYields != 10 {
+		t.Fatal("unexpected stats", doc)
+	}
+	if ratio := getExaminedRatio(doc); ratio != "2500" {
+		t.Fatal("expected 2500, but got", ratio)
+	}
+}
+
+func getTestLogLines(n int) []string {
+	lines := []string{
+		`2020-05-12T12:48:14.398-0400 I COMMAND [conn1] command keyhole.cars command: find { find: "cars", filter: { color: "Red" }, $db: "keyhole" } planSummary: COLLSCAN keysExamined:0 docsExamined:100 numYields:0 nreturned:1 reslen:100 protocol:op_msg %dms`,
+		`2020-05-12T12:49:14.398-0400 I COMMAND [conn2] command keyhole.cars command: find { find: "cars", filter: { color: "Red", year: 2020 }, $db: "keyhole" } planSummary: IXSCAN { color: 1 } keysExamined:1 docsExamined:1 numYields:0 nreturned:1 reslen:100 protocol:op_msg %dms`,
+		`2020-05-12T12:50:14.398-0400 I WRITE   [conn3] update keyhole.cars command: { q: { _id: ObjectId('5ebad7a4a7d7b2d6a2e4b9a1') }, u: { $set: { color: "Blue" } } } planSummary: IDHACK keysExamined:1 docsExamined:1 nMatched:1 nModified:1 numYields:0 %dms`,
+	}
+	strs := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		strs = append(strs, fmt.Sprintf(lines[i%len(lines)], 100+(i*7919)%5000))
+	}
+	return strs
+}
+
+func TestLogInfoParseParallel(t *testing.T) {
+	str := strings.Join(getTestLogLines(5000), "\n")
+	serial := NewLogInfo()
+	serial.SetSilent(true)
+	serial.SetWorkers(1)
+	if err := serial.Parse(bufio.NewReader(strings.NewReader(str))); err != nil {
+		t.Fatal(err)
+	}
+	parallel := NewLogInfo()
+	parallel.SetSilent(true)
+	parallel.SetWorkers(4)
+	if err := parallel.Parse(bufio.NewReader(strings.NewReader(str))); err != nil {
+		t.Fatal(err)
+	}
+	if len(serial.OpsPatterns) != 3 {
+		t.Fatal("expected 3 patterns, but got", len(serial.OpsPatterns))
+	}
+	if reflect.DeepEqual(serial.OpsPatterns, parallel.OpsPatterns) == false ||
+		reflect.DeepEqual(serial.SlowOps, parallel.SlowOps) == false ||
+		reflect.DeepEqual(serial.Timeline, parallel.Timeline) == false {
+		t.Fatal("parallel parsing is different from serial parsing")
+	}
+}
+
+func benchmarkLogInfoParse(b *testing.B, workers int) {
+	str := strings.Join(getTestLogLines(20000), "\n")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		loginfo := NewLogInfo()
+		loginfo.SetSilent(true)
+		loginfo.SetWorkers(workers)
+		if err := loginfo.Parse(bufio.NewReader(strings.NewReader(str))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLogInfoParseSerial(b *testing.B) {
+	benchmarkLogInfoParse(b, 1)
+}
+
+func BenchmarkLogInfoParseParallel(b *testing.B) {
+	benchmarkLogInfoParse(b, runtime.NumCPU())
+}
+
+func TestLogInfoEvents(t *testing.T) {
+	lines := []string{
+		`2020-05-12T12:50:00.000-0400 I  REPL     [replexec-5] Starting an election, since we've seen no PRIMARY in the past 10000ms`,
+		`2020-05-12T12:51:00.000-0400 I  REPL     [replexec-5] transition to PRIMARY from SECONDARY`,
+		`2020-05-12T12:52:00.000-0400 I  REPL_HB  [replexec-6] Error in heartbeat (requestId: 1) to host2:27017, response status: HostUnreachable`,
+		`2020-05-12T12:52:00.000-0400 I  REPL_HB  [replexec-6] Error in heartbeat (requestId: 1) to host2:27017, response status: HostUnreachable`,
+		`2020-05-12T12:53:00.000-0400 I  REPL     [replexec-7] Scheduling remote command request`,
+	}
+	loginfo := NewLogInfo()
+	loginfo.SetSilent(true)
+	if err := loginfo.Parse(bufio.NewReader(strings.NewReader(strings.Join(lines, "\n")))); err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.Events) != 3 {
+		t.Fatal("expected 3 events, but got", len(loginfo.Events))
+	}
+	if e := loginfo.Events[2]; e.Type != "heartbeat" || e.Count != 2 {
+		t.Fatal("unexpected event", e)
+	}
+
+	str := `{"t":{"$date":"2020-08-01T10:05:00.000+00:00"},"s":"I","c":"REPL","id":21358,"ctx":"ReplCoord-1","msg":"Replica set state transition","attr":{"newState":"PRIMARY","oldState":"SECONDARY"}}`
+	line, ok := getLogLine(logTypeLogv2, str)
+	if !ok {
+		t.Fatal("expected logv2 line decoded")
+	}
+	if e := getLogEvent(line); e == nil || e.Type != "state" || e.Time.IsZero() {
+		t.Fatal("unexpected event", e)
+	}
+}
+
+func TestLogInfoIssues(t *testing.T) {
+	lines := []string{
+		`2020-05-12T12:50:18.000-0400 W  STORAGE  [conn6801] WriteConflict exception thrown in update on keyhole.cars`,
+		`2020-05-12T12:50:19.000-0400 E  NETWORK  [conn6802] SocketException: too many open files 10.0.0.9:27017`,
+		`2020-05-12T12:50:29.000-0400 E  NETWORK  [conn6803] SocketException: too many open files 10.0.0.8:27017`,
+		`2020-05-12T12:50:39.000-0400 I  NETWORK  [conn6804] end connection 10.0.0.8:50123 (3 connections now open)`,
+	}
+	loginfo := NewLogInfo()
+	loginfo.SetSilent(true)
+	if err := loginfo.Parse(bufio.NewReader(strings.NewReader(strings.Join(lines, "\n")))); err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.Issues) != 2 {
+		t.Fatal("expected 2 kinds, but got", len(loginfo.Issues))
+	}
+	doc := loginfo.Issues[0]
+	if doc.Severity != "E" || doc.Count != 2 || doc.Message != "SocketException: too many open files <host>" ||
+		doc.Last.Sub(doc.First) != 10*time.Second {
+		t.Fatal("unexpected issue", doc)
+	}
+
+	str := `{"t":{"$date":"2020-08-01T10:04:01.000+00:00"},"s":"E","c":"NETWORK","id":23077,"ctx":"conn13","msg":"Error sending response to client","attr":{"error":"too many open files"}}`
+	line, _ := getLogLine(logTypeLogv2, str)
+	if issue := getLogIssue(line, str); issue == nil || issue.ID != 23077 || issue.Message != "Error sending response to client" {
+		t.Fatal("unexpected issue", issue)
+	}
+}
+
+func TestLogInfoTransactions(t *testing.T) {
+	lines := []string{
+		`{"t":{"$date":"2020-08-01T10:03:09.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"update":"cars","updates":[{"q":{"_id":1},"u":{"$set":{"color":"Red"}}}],"lsid":{"id":{"$uuid":"11111111-1111-1111-1111-111111111111"}},"txnNumber":3,"autocommit":false,"$db":"keyhole"},"numYields":0,"reslen":230,"protocol":"op_msg","durationMillis":110}}`,
+		`{"t":{"$date":"2020-08-01T10:03:10.000+00:00"},"s":"I","c":"TXN","id":51802,"ctx":"conn12","msg":"transaction","attr":{"parameters":{"lsid":{"id":{"$uuid":"11111111-1111-1111-1111-111111111111"}},"txnNumber":3,"autocommit":false,"readConcern":{"level":"snapshot"}},"terminationCause":"committed","timeActiveMicros":3000,"timeInactiveMicros":120000,"numYields":0,"durationMillis":123}}`,
+		`{"t":{"$date":"2020-08-01T10:03:20.000+00:00"},"s":"I","c":"TXN","id":51802,"ctx":"conn13","msg":"transaction","attr":{"parameters":{"lsid":{"id":{"$uuid":"22222222-1111-1111-1111-111111111111"}},"txnNumber":1,"autocommit":false,"readConcern":{"level":"snapshot"}},"terminationCause":"aborted","errCode":112,"errName":"WriteConflict","errMsg":"WriteConflict error","timeActiveMicros":1000,"timeInactiveMicros":500000,"numYields":0,"durationMillis":501}}`,
+	}
+	loginfo := NewLogInfo()
+	loginfo.SetSilent(true)
+	if err := loginfo.Parse(bufio.NewReader(strings.NewReader(strings.Join(lines, "\n")))); err != nil {
+		t.Fatal(err)
+	}
+	doc := loginfo.Transactions
+	if doc.Count != 2 || doc.Committed != 1 || doc.Aborted != 1 || doc.AbortCauses["WriteConflict"] != 1 {
+		t.Fatal("unexpected transactions", doc)
+	}
+	if doc.Namespaces["keyhole.cars"] != 1 || doc.ReadConcerns["snapshot"] != 2 || doc.MaxInactive != 500 {
+		t.Fatal("unexpected transactions", doc)
+	}
+	t.Log(loginfo.printTransactions())
+}
+
+func TestLogInfoClients(t *testing.T) {
+	lines := []string{
+		`2020-05-12T12:50:59.100-0400 I  NETWORK  [listener] connection accepted from 10.0.0.5:53824 #12 (3 connections now open)`,
+		`2020-05-12T12:50:59.200-0400 I  NETWORK  [conn12] received client metadata from 10.0.0.5:53824 conn12: { driver: { name: "nodejs", version: "3.6.0" }, os: { type: "Linux" }, platform: "'Node.js v12.18.0, LE", application: { name: "orders" } }`,
+		`2020-05-12T12:51:00.000-0400 I  COMMAND  [conn12] command keyhole.cars command: find { find: "cars", filter: { color: "Red" }, $db: "keyhole" } planSummary: COLLSCAN keysExamined:0 docsExamined:5000 numYields:39 nreturned:5 reslen:200 protocol:op_msg 320ms`,
+		`2020-05-12T12:51:30.000-0400 I  NETWORK  [conn12] end connection 10.0.0.5:53824 (2 connections now open)`,
+	}
+	loginfo := NewLogInfo()
+	loginfo.SetSilent(true)
+	if err := loginfo.Parse(bufio.NewReader(strings.NewReader(strings.Join(lines, "\n")))); err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.OpsPatterns) != 1 || len(loginfo.OpsPatterns[0].Apps) != 1 {
+		t.Fatal("unexpected ops patterns", loginfo.OpsPatterns)
+	}
+	if str := getAppString(loginfo.OpsPatterns[0].Apps[0]); str != "orders (nodejs 3.6.0) 10.0.0.5" {
+		t.Fatal("unexpected app", str)
+	}
+	doc := loginfo.Clients
+	if doc.Accepted != 1 || doc.Ended != 1 || doc.MaxOpen != 3 || doc.Drivers["nodejs 3.6.0"] != 1 || len(doc.Churn) != 2 {
+		t.Fatal("unexpected clients", doc)
+	}
+	t.Log(loginfo.printClients())
+
+	lines = []string{
+		`{"t":{"$date":"2020-05-12T16:52:00.000+00:00"},"s":"I","c":"NETWORK","id":22943,"ctx":"listener","msg":"Connection accepted","attr":{"remote":"10.0.0.7:40000","connectionId":13,"connectionCount":3}}`,
+		`{"t":{"$date":"2020-05-12T16:52:00.100+00:00"},"s":"I","c":"NETWORK","id":51800,"ctx":"conn13","msg":"client metadata","attr":{"remote":"10.0.0.7:40000","client":"conn13","doc":{"driver":{"name":"mongo-java-driver|sync","version":"4.0.5"},"os":{"type":"Linux"},"platform":"Java/11"}}}`,
+		`{"t":{"$date":"2020-05-12T16:52:01.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn13","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","appName":"billing","command":{"find":"cars","filter":{"color":"Blue"},"$db":"keyhole"},"planSummary":"COLLSCAN","keysExamined":0,"docsExamined":5000,"nreturned":5,"reslen":200,"durationMillis":410}}`,
+	}
+	if err := loginfo.Parse(bufio.NewReader(strings.NewReader(strings.Join(lines, "\n")))); err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.OpsPatterns) != 1 || len(loginfo.OpsPatterns[0].Apps) != 1 {
+		t.Fatal("unexpected ops patterns", loginfo.OpsPatterns)
+	}
+	if str := getAppString(loginfo.OpsPatterns[0].Apps[0]); str != "billing (mongo-java-driver|sync 4.0.5) 10.0.0.7" {
+		t.Fatal("unexpected app", str)
+	}
+}
+
+func TestGetTopApps(t *testing.T) {
+	apps := []AppPerformanceDoc{}
+	for i := 1; i <= topApps+2; i++ {
+		apps = append(apps, AppPerformanceDoc{App: fmt.Sprintf("app%d", i), Count: 1, MaxMilli: i * 10,
+			Remote: "10.0.0.1", TotalMilli: i * 10})
+	}
+	tops := getTopApps(apps)
+	if len(tops) != topApps+1 || tops[0].App != fmt.Sprintf("app%d", topApps+2) {
+		t.Fatal("expected top apps of the most time, but got", tops)
+	}
+	if others := tops[topApps]; getAppString(others) != "2 others" || others.Count != 2 || others.TotalMilli != 30 ||
+		others.MaxMilli != 20 {
+		t.Fatal("unexpected others", others)
+	}
+	if len(getTopApps(apps[:topApps])) != topApps {
+		t.Fatal("expected apps not rolled up")
+	}
+}
+
+func TestLogInfoPlanFlips(t *testing.T) {
+	line := `{"t":{"$date":"2020-08-01T10:0%d:00.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"find":"cars","filter":{"color":"Red","year":2020},"$db":"keyhole"},"planSummary":"%v","keysExamined":10,"docsExamined":10,"nreturned":4,"queryHash":"%v","planCacheKey":"EF567890","durationMillis":%d}}`
+	lines := []string{
+		fmt.Sprintf(line, 1, "IXSCAN { color: 1, year: 1 }", "ABCD1234", 110),
+		fmt.Sprintf(line, 2, "IXSCAN { color: 1, year: 1 }", "ABCD1234", 120),
+		fmt.Sprintf(line, 3, "COLLSCAN", "ABCD1234", 2300),
+		fmt.Sprintf(line, 4, "IXSCAN { color: 1, year: 1 }", "ABCD1234", 130),
+		fmt.Sprintf(line, 5, "IXSCAN { year: 1 }", "1234ABCD", 140),
+	}
+	loginfo := NewLogInfo()
+	loginfo.SetSilent(true)
+	if err := loginfo.Parse(bufio.NewReader(strings.NewReader(strings.Join(lines, "\n")))); err != nil {
+		t.Fatal(err)
+	}
+	if len(loginfo.PlanFlips) != 1 {
+		t.Fatal("expected 1 query shape of plan flips, but got", len(loginfo.PlanFlips))
+	}
+	doc := loginfo.PlanFlips[0]
+	if doc.QueryHash != "ABCD1234" || doc.NumFlips != 2 || len(doc.Plans) != 2 || doc.Plans[1].Plan != COLLSCAN ||
+		doc.Plans[0].Count != 3 || doc.Plans[1].MaxMilli != 2300 {
+		t.Fatal("unexpected plan flips", doc)
+	}
+	if flip := doc.Flips[0]; flip.From != "IXSCAN { color: 1, year: 1 }" || flip.To != COLLSCAN || flip.Time.Minute() != 3 {
+		t.Fatal("unexpected flip", flip)
+	}
+	t.Log(loginfo.printPlanFlips())
+}
@@ -6,18 +6,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"regexp"
 	"strings"
-
-	"github.com/simagix/gox"
+	"time"
 )
 
-var ops = []string{cmdAggregate, cmdCreateIndexes, cmdDelete, cmdFind, cmdGetMore, cmdInsert, cmdUpdate}
+var ops = []string{cmdAggregate, cmdCount, cmdCreateIndexes, cmdDelete, cmdDistinct, cmdFind, cmdFindAndModify, cmdGetMore,
+	cmdInsert, cmdUpdate}
 
 const cmdAggregate = "aggregate"
+const cmdCount = "count"
 const cmdCreateIndexes = "createIndexes"
 const cmdDelete = "delete"
+const cmdDistinct = "distinct"
 const cmdFind = "find"
+const cmdFindAndModify = "findAndModify"
 const cmdGetMore = "getMore"
 const cmdInsert = "insert"
 const cmdRemove = "remove"
@@ -40,6 +42,22 @@ func (li *LogInfo) ParseLogv2(str string) (LogStats, error) {
 		return stat, errors.New("no attr found")
 	}
 	stat.milli = toInt(attr["durationMillis"])
+	stat.utc = getLogv2Time(doc)
+	stat.keysExamined = toInt(attr["keysExamined"])
+	stat.docsExamined = toInt(attr["docsExamined"])
+	stat.nreturned = toInt(attr["nreturned"])
+	stat.numYields = toInt(attr["numYields"])
+	stat.reslen = toInt(attr["reslen"])
+	stat.waits = getLogv2Waits(attr)
+	stat.conn, _ = doc["ctx"].(string)
+	stat.app, _ = attr["appName"].(string)
+	stat.remote, _ = attr["remote"].(string)
+	if attr["queryHash"] != nil {
+		stat.queryHash = fmt.Sprintf("%v", attr["queryHash"])
+	}
+	if attr["planCacheKey"] != nil {
+		stat.planCacheKey = fmt.Sprintf("%v", attr["planCacheKey"])
+	}
 	if attr["ns"] != nil {
 		stat.ns = attr["ns"].(string)
 	} else if attr["namespace"] != nil { // likely "c": "SHARDING", ignored already
@@ -73,6 +91,7 @@ func (li *LogInfo) ParseLogv2(str string) (LogStats, error) {
 		return stat, errors.New("no command found")
 	}
 	command := attr["command"].(map[string]interface{})
+	stat.txn = getTxnKey(command)
 	if attr["type"] != nil {
 		stat.op = attr["type"].(string)
 	}
@@ -86,88 +105,26 @@ func (li *LogInfo) ParseLogv2(str string) (LogStats, error) {
 		}
 
 	}
-	if stat.op == cmdFind || stat.op == cmdGetMore {
-		if command["filter"] == nil {
-			stat.filter = "{}"
-		} else {
-			fmap := command["filter"].(map[string]interface{})
-			if isRegex(fmap) == false {
-				walker := gox.NewMapWalker(cb)
-				doc := walker.Walk(fmap)
-				if buf, err := json.Marshal(doc); err == nil {
-					stat.filter = string(buf)
-				} else {
-					stat.filter = "{}"
-				}
-			} else {
-				buf, _ := json.Marshal(fmap)
-				str := string(buf)
-				re := regexp.MustCompile(`{(.*):{"\$regularExpression":{"options":"(\S+)?","pattern":"(\^)?(\S+)"}}}`)
-				stat.filter = re.ReplaceAllString(str, "{$1:/$3.../$2}")
-			}
-		}
-	} else if stat.op == cmdInsert || stat.op == cmdCreateIndexes {
-		stat.filter = "N/A"
-	} else if (stat.op == cmdUpdate || stat.op == cmdRemove || stat.op == cmdDelete) && stat.filter == "" {
-		walker := gox.NewMapWalker(cb)
-		doc := walker.Walk(command["q"].(map[string]interface{}))
-		if buf, err := json.Marshal(doc); err == nil {
-			stat.filter = string(buf)
-		} else {
-			stat.filter = "{}"
-		}
-	} else if stat.op == cmdAggregate {
-		pipeline := command["pipeline"].([]interface{})
-		var stage interface{}
-		for _, v := range pipeline {
-			stage = v
-			break
-		}
-		fmap := stage.(map[string]interface{})
-		if isRegex(fmap) == false {
-			walker := gox.NewMapWalker(cb)
-			doc := walker.Walk(fmap)
-			if buf, err := json.Marshal(doc); err == nil {
-				stat.filter = string(buf)
-			} else {
-				stat.filter = "{}"
-			}
-			if strings.Index(stat.filter, "$match") < 0 && strings.Index(stat.filter, "$sort") < 0 &&
-				strings.Index(stat.filter, "$facet") < 0 {
-				stat.filter = "{}"
-			}
-		} else {
-			buf, _ := json.Marshal(fmap)
-			str := string(buf)
-			re := regexp.MustCompile(`{(.*):{"\$regularExpression":{"options":"(\S+)?","pattern":"(\^)?(\S+)"}}}`)
-			stat.filter = re.ReplaceAllString(str, "{$1:/$3.../$2}")
-		}
-	} else if li.verbose == true {
-		fmt.Println(stat.op, str)
-	}
 	if stat.op == "" {
 		return stat, nil
 	}
-	re := regexp.MustCompile(`\[(1,)*1\]`)
-	stat.filter = re.ReplaceAllString(stat.filter, `[...]`)
-	re = regexp.MustCompile(`^{("\$match"|"\$sort"):(\S+)}$`)
-	stat.filter = re.ReplaceAllString(stat.filter, `$2`)
-	re = regexp.MustCompile(`^{("(\$facet")):\S+}$`)
-	stat.filter = re.ReplaceAllString(stat.filter, `{$1:...}`)
-	re = regexp.MustCompile(`{"\$oid":1}`)
-	stat.filter = re.ReplaceAllString(stat.filter, `1`)
+	cmd, _ := getLogValue(str, `"command":`).(logDoc)
+	orig, _ := getLogValue(str, `"originatingCommand":`).(logDoc)
+	if stat.filter, ok = getCommandShape(stat.op, cmd, orig); !ok {
+		if li.verbose == true {
+			fmt.Println(stat.op, str)
+		}
+		stat.op = ""
+	}
 	return stat, nil
 }
 
-func isRegex(doc map[string]interface{}) bool {
-	if buf, err := json.Marshal(doc); err != nil {
-		return false
-	} else if strings.Index(string(buf), "$regularExpression") >= 0 {
-		return true
+// getLogv2Time returns the timestamp from t.$date
+func getLogv2Time(doc map[string]interface{}) time.Time {
+	if t, ok := doc["t"].(map[string]interface{}); ok {
+		if str, ok := t["$date"].(string); ok {
+			return getLogTime(str)
+		}
 	}
-	return false
-}
-
-func cb(value interface{}) interface{} {
-	return 1
+	return time.Time{}
 }
@@ -12,7 +12,7 @@ func TestParseLogv2(t *testing.T) {
 	loginfo.SetVerbose(true)
 	if stat, err := loginfo.ParseLogv2(str); err != nil {
 		t.Fatal(err)
-	} else if stat.filter != `{"_search":1}` {
+	} else if stat.filter != `{_search:1}` {
 		t.Log(stat.filter)
 		t.Fatal(stat.filter)
 	}
@@ -0,0 +1,493 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// logDoc is an ordered document parsed from a text or logv2 line
+type logDoc []logElem
+
+// logElem is a field of a logDoc
+type logElem struct {
+	key   string
+	value interface{}
+}
+
+// logScalar is a value other than a document or an array
+type logScalar struct {
+	kind string
+	raw  string
+}
+
+// kinds of logScalar
+const (
+	kindBool     = "bool"
+	kindDate     = "date"
+	kindNull     = "null"
+	kindNumber   = "number"
+	kindObjectID = "objectId"
+	kindOther    = "other"
+	kindRegex    = "regex"
+	kindString   = "string"
+)
+
+// get returns value of a key, or nil
+func (doc logDoc) get(key string) interface{} {
+	for _, e := range doc {
+		if e.key == key {
+			return e.value
+		}
+	}
+	return nil
+}
+
+// getDoc returns document of a key, or nil
+func (doc logDoc) getDoc(key string) logDoc {
+	d, _ := doc.get(key).(logDoc)
+	return d
+}
+
+// logDocParser parses documents of text logs, for example { a: "x", b: new Date(1), c: /^x/i },
+// and JSON of logv2, keys are kept in order
+type logDocParser struct {
+	pos int
+	str string
+}
+
+// parseLogDoc parses a document or a value at the beginning of a string, the rest is ignored
+// and a truncated document is closed at the end
+func parseLogDoc(str string) interface{} {
+	p := &logDocParser{str: str}
+	return p.parseValue()
+}
+
+// getLogValue parses the value after a key, for example "originatingCommand: " or `"command":`
+func getLogValue(str string, key string) interface{} {
+	i := strings.Index(str, key)
+	if i < 0 {
+		return nil
+	}
+	return parseLogDoc(str[i+len(key):])
+}
+
+func (p *logDocParser) parseValue() interface{} {
+	p.skipSpaces()
+	if p.pos >= len(p.str) {
+		return logScalar{kind: kindOther}
+	}
+	c := p.str[p.pos]
+	switch {
+	case c == '{':
+		return p.parseDoc()
+	case c == '[':
+		return p.parseArray()
+	case c == '"' || c == '\'':
+		return logScalar{kind: kindString, raw: p.parseString()}
+	case c == '/':
+		return logScalar{kind: kindRegex, raw: p.parseRegex()}
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		return logScalar{kind: kindNumber, raw: p.parseToken()}
+	}
+	token := p.parseToken()
+	switch token {
+	case "true", "false":
+		return logScalar{kind: kindBool, raw: token}
+	case "null", "undefined":
+		return logScalar{kind: kindNull, raw: token}
+	case "new": // new Date(1589169600000)
+		return p.parseValue()
+	}
+	p.skipSpaces()
+	if p.pos < len(p.str) && p.str[p.pos] == '(' {
+		args := p.parseParens()
+		switch token {
+		case "Date", "ISODate":
+			return logScalar{kind: kindDate, raw: token + args}
+		case "ObjectId":
+			return logScalar{kind: kindObjectID, raw: token + args}
+		case "NumberInt", "NumberLong", "NumberDecimal":
+			return logScalar{kind: kindNumber, raw: strings.Trim(args, `()"'`)}
+		}
+		return logScalar{kind: kindOther, raw: token + args}
+	}
+	return logScalar{kind: kindOther, raw: strings.TrimSpace(token + " " + p.parseUntilDelimiter())} // Timestamp 0|0
+}
+
+func (p *logDocParser) parseDoc() interface{} {
+	doc := logDoc{}
+	p.pos++ // {
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.str) {
+			break
+		}
+		c := p.str[p.pos]
+		if c == '}' {
+			p.pos++
+			break
+		} else if c == ',' {
+			p.pos++
+			continue
+		}
+		var key string
+		if c == '"' || c == '\'' {
+			key = p.parseString()
+		} else {
+			key = p.parseToken()
+		}
+		p.skipSpaces()
+		if p.pos < len(p.str) && p.str[p.pos] == ':' {
+			p.pos++
+		} else if key == "" { // unexpected character
+			p.pos++
+			continue
+		}
+		doc = append(doc, logElem{key: key, value: p.parseValue()})
+	}
+	return getExtJSONScalar(doc)
+}
+
+func (p *logDocParser) parseArray() interface{} {
+	array := []interface{}{}
+	p.pos++ // [
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.str) {
+			break
+		}
+		c := p.str[p.pos]
+		if c == ']' {
+			p.pos++
+			break
+		} else if c == ',' {
+			p.pos++
+			continue
+		}
+		pos := p.pos
+		value := p.parseValue()
+		if p.pos == pos { // unexpected character
+			p.pos++
+			continue
+		}
+		array = append(array, value)
+	}
+	return array
+}
+
+func (p *logDocParser) parseString() string {
+	quote := p.str[p.pos]
+	p.pos++
+	var buffer strings.Builder
+	for p.pos < len(p.str) {
+		c := p.str[p.pos]
+		p.pos++
+		if c == '\\' && p.pos < len(p.str) {
+			buffer.WriteByte(p.str[p.pos])
+			p.pos++
+		} else if c == quote {
+			break
+		} else {
+			buffer.WriteByte(c)
+		}
+	}
+	return buffer.String()
+}
+
+// parseRegex returns a regex and its options, for example /^abc/i
+func (p *logDocParser) parseRegex() string {
+	begin := p.pos
+	p.pos++
+	for p.pos < len(p.str) && p.str[p.pos] != '/' {
+		if p.str[p.pos] == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	p.pos++
+	for p.pos < len(p.str) && p.str[p.pos] >= 'a' && p.str[p.pos] <= 'z' {
+		p.pos++
+	}
+	if p.pos > len(p.str) {
+		p.pos = len(p.str)
+	}
+	return p.str[begin:p.pos]
+}
+
+// parseToken returns a key, a number, or a name
+func (p *logDocParser) parseToken() string {
+	begin := p.pos
+	for p.pos < len(p.str) && strings.IndexByte(" \t\r\n,:{}[]()", p.str[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.str[begin:p.pos]
+}
+
+// parseParens returns arguments in parentheses, including the parentheses
+func (p *logDocParser) parseParens() string {
+	begin := p.pos
+	depth := 0
+	for p.pos < len(p.str) {
+		c := p.str[p.pos]
+		if c == '"' || c == '\'' {
+			p.parseString()
+			continue
+		}
+		p.pos++
+		if c == '(' {
+			depth++
+		} else if c == ')' {
+			if depth--; depth == 0 {
+				break
+			}
+		}
+	}
+	return p.str[begin:p.pos]
+}
+
+// parseUntilDelimiter returns the rest of a value before , } or ]
+func (p *logDocParser) parseUntilDelimiter() string {
+	begin := p.pos
+	for p.pos < len(p.str) && strings.IndexByte(",}]", p.str[p.pos]) < 0 {
+		p.pos++
+	}
+	return strings.TrimSpace(p.str[begin:p.pos])
+}
+
+func (p *logDocParser) skipSpaces() {
+	for p.pos < len(p.str) && strings.IndexByte(" \t\r\n", p.str[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// getExtJSONScalar returns a scalar of an extended JSON value, for example {"$oid":"..."},
+// or the document itself
+func getExtJSONScalar(doc logDoc) interface{} {
+	if len(doc) != 1 || strings.HasPrefix(doc[0].key, "$") == false {
+		return doc
+	}
+	value, _ := doc[0].value.(logScalar)
+	switch doc[0].key {
+	case "$date":
+		return logScalar{kind: kindDate, raw: value.raw}
+	case "$oid":
+		return logScalar{kind: kindObjectID, raw: value.raw}
+	case "$numberDecimal", "$numberDouble", "$numberInt", "$numberLong":
+		return logScalar{kind: kindNumber, raw: value.raw}
+	case "$regularExpression":
+		re, _ := doc[0].value.(logDoc)
+		pattern, _ := re.get("pattern").(logScalar)
+		options, _ := re.get("options").(logScalar)
+		return logScalar{kind: kindRegex, raw: "/" + pattern.raw + "/" + options.raw}
+	case "$binary", "$code", "$maxKey", "$minKey", "$symbol", "$timestamp", "$undefined", "$uuid":
+		return logScalar{kind: kindOther, raw: doc[0].key}
+	}
+	return doc
+}
+
+// getFilterShape returns the canonical shape of a query filter, keys are sorted, values are
+// replaced with 1, arrays with [...], and regexes with /.../ keeping the prefix anchor and options
+func getFilterShape(v interface{}) string {
+	return getFilterShapeOf(v, "")
+}
+
+func getFilterShapeOf(v interface{}, parent string) string {
+	switch x := v.(type) {
+	case nil:
+		return "{}"
+	case logDoc:
+		if re, ok := getRegexOperator(x); ok {
+			return re
+		}
+		elems := append(logDoc{}, x...)
+		sort.SliceStable(elems, func(i, j int) bool { return elems[i].key < elems[j].key })
+		strs := make([]string, 0, len(elems))
+		for _, e := range elems {
+			strs = append(strs, e.key+":"+getFilterShapeOf(e.value, e.key))
+		}
+		return "{" + strings.Join(strs, ", ") + "}"
+	case []interface{}:
+		if parent != "$and" && parent != "$or" && parent != "$nor" {
+			return "[...]"
+		}
+		strs := make([]string, 0, len(x))
+		for _, e := range x {
+			strs = append(strs, getFilterShapeOf(e, ""))
+		}
+		return "[" + strings.Join(strs, ", ") + "]"
+	case logScalar:
+		if x.kind == kindRegex {
+			return getRegexShape(x.raw)
+		}
+	}
+	return "1"
+}
+
+// getRegexOperator returns shape of {$regex: "^abc", $options: "i"}
+func getRegexOperator(doc logDoc) (string, bool) {
+	re, ok := doc.get("$regex").(logScalar)
+	if !ok || len(doc) > 2 {
+		return "", false
+	}
+	pattern := re.raw
+	if re.kind == kindRegex {
+		return getRegexShape(pattern), true
+	}
+	options, _ := doc.get("$options").(logScalar)
+	return getRegexShape("/" + pattern + "/" + options.raw), true
+}
+
+// getRegexShape returns /.../ keeping the prefix anchor and options, for example /^.../i
+func getRegexShape(regex string) string {
+	i := strings.LastIndex(regex, "/")
+	if i <= 0 {
+		return "/.../"
+	}
+	shape := "/"
+	if strings.HasPrefix(regex, "/^") {
+		shape += "^"
+	}
+	return shape + ".../" + regex[i+1:]
+}
+
+// getSpecShape returns the shape of a sort, projection, or group spec, keys are kept in order,
+// numbers and field paths are kept, and other values are replaced with 1
+func getSpecShape(v interface{}) string {
+	switch x := v.(type) {
+	case logDoc:
+		strs := make([]string, 0, len(x))
+		for _, e := range x {
+			strs = append(strs, e.key+":"+getSpecShape(e.value))
+		}
+		return "{" + strings.Join(strs, ", ") + "}"
+	case []interface{}:
+		strs := make([]string, 0, len(x))
+		for _, e := range x {
+			strs = append(strs, getSpecShape(e))
+		}
+		return "[" + strings.Join(strs, ", ") + "]"
+	case logScalar:
+		if x.kind == kindNumber {
+			if f, err := strconv.ParseFloat(x.raw, 64); err == nil {
+				return strconv.FormatFloat(f, 'f', -1, 64)
+			}
+		} else if x.kind == kindString && strings.HasPrefix(x.raw, "$") {
+			return strconv.Quote(x.raw)
+		} else if x.kind == kindBool {
+			return x.raw
+		}
+	}
+	return "1"
+}
+
+// getCommandShape returns the canonical query shape of a command of text or logv2 logs, orig is
+// the originating command of a getMore, and false if the command has no query shape
+func getCommandShape(op string, cmd logDoc, orig logDoc) (string, bool) {
+	switch op {
+	case cmdInsert, cmdCreateIndexes:
+		return "N/A", true
+	case cmdFind:
+		return getFindShape(cmd), true
+	case cmdCount:
+		return getFilterShape(cmd.get("query")), true
+	case cmdDistinct:
+		key, _ := cmd.get("key").(logScalar)
+		return "{" + key.raw + ":1}", true
+	case cmdDelete, cmdFindAndModify, cmdRemove, cmdUpdate:
+		return getFilterShape(getWriteFilter(cmd)), true
+	case cmdAggregate:
+		return getPipelineShape(cmd.get("pipeline")), true
+	case cmdGetMore:
+		if orig == nil {
+			return "", false
+		} else if orig.get("pipeline") != nil {
+			return getPipelineShape(orig.get("pipeline")), true
+		}
+		return getFindShape(orig), true
+	}
+	return "", false
+}
+
+// getFindShape returns the filter shape of a find command, followed by its sort spec
+func getFindShape(cmd logDoc) string {
+	shape := getFilterShape(cmd.get("filter"))
+	if sort := cmd.getDoc("sort"); len(sort) > 0 {
+		shape += ", sort: " + getSpecShape(sort)
+	}
+	return shape
+}
+
+// getWriteFilter returns q or query of a write op, or q of the first statement of an update or delete command
+func getWriteFilter(cmd logDoc) interface{} {
+	for _, key := range []string{"q", "query"} {
+		if q := cmd.get(key); q != nil {
+			return q
+		}
+	}
+	for _, key := range []string{"updates", "deletes"} {
+		if stmts, ok := cmd.get(key).([]interface{}); ok && len(stmts) > 0 {
+			if stmt, ok := stmts[0].(logDoc); ok {
+				return stmt.get("q")
+			}
+		}
+	}
+	return nil
+}
+
+// getPipelineShape returns the shape of an aggregation pipeline, stage names in order with
+// normalized $match filters, $group and $sort specs, and sub-pipelines of $facet, $lookup, and $unionWith
+func getPipelineShape(v interface{}) string {
+	pipeline, _ := v.([]interface{})
+	strs := make([]string, 0, len(pipeline))
+	for _, value := range pipeline {
+		if stage, ok := value.(logDoc); ok && len(stage) > 0 {
+			strs = append(strs, "{"+stage[0].key+":"+getStageShape(stage[0].key, stage[0].value)+"}")
+		}
+	}
+	return "[" + strings.Join(strs, ", ") + "]"
+}
+
+// getStageShape returns the shape of a pipeline stage, other than listed stages are replaced with 1
+func getStageShape(name string, value interface{}) string {
+	switch name {
+	case "$match":
+		return getFilterShape(value)
+	case "$bucket", "$group", "$sort", "$sortByCount", "$unwind":
+		return getSpecShape(value)
+	case "$facet":
+		facets, _ := value.(logDoc)
+		strs := make([]string, 0, len(facets))
+		for _, facet := range facets {
+			strs = append(strs, facet.key+":"+getPipelineShape(facet.value))
+		}
+		return "{" + strings.Join(strs, ", ") + "}"
+	case "$graphLookup", "$lookup", "$unionWith":
+		if coll, ok := value.(logScalar); ok { // { $unionWith: "coll" }
+			return strconv.Quote(coll.raw)
+		}
+		doc, _ := value.(logDoc)
+		strs := []string{}
+		for _, key := range []string{"from", "coll", "localField", "foreignField", "connectFromField", "connectToField"} {
+			if field, ok := doc.get(key).(logScalar); ok {
+				strs = append(strs, key+":"+strconv.Quote(field.raw))
+			}
+		}
+		if pipeline := doc.get("pipeline"); pipeline != nil {
+			strs = append(strs, "pipeline:"+getPipelineShape(pipeline))
+		}
+		return "{" + strings.Join(strs, ", ") + "}"
+	}
+	return "1"
+}
+
+// getShapeID returns a stable fingerprint of a query pattern
+func getShapeID(op string, ns string, filter string) string {
+	h := fnv.New64a()
+	h.Write([]byte(op + " " + ns + " " + filter))
+	return fmt.Sprintf("%016X", h.Sum64())
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 Kuei-chun Chen. All rights reserved.
+
+package mdb
+
+import (
+	"testing"
+)
+
+func TestQueryShape(t *testing.T) {
+	text := `2020-05-11T04:00:00.123+0000 I COMMAND  [conn12] command keyhole.cars appName: "MongoDB Shell" command: find { find: "cars", filter: { year: { $gt: 2015 }, color: { $in: [ "Red", "Blue" ] }, brand: /^Ford/i, dealer: ObjectId('5ea9c0a1f2a4e0f5f0b1b1b1'), sold: new Date(1589169600000) }, sort: { price: -1.0 }, lsid: { id: UUID("a8b4f7e2-1f7a-4a39-9c8c-5b8c2f6e2a11") }, $db: "keyhole" } planSummary: IXSCAN { color: 1, year: 1 } keysExamined:120 docsExamined:120 nreturned:10 reslen:2048 protocol:op_msg 210ms`
+	v2 := `{"t":{"$date":"2020-09-11T04:00:00.123+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","appName":"MongoDB Shell","command":{"find":"cars","filter":{"sold":{"$date":"2020-05-11T04:00:00.000Z"},"dealer":{"$oid":"5ea9c0a1f2a4e0f5f0b1b1b1"},"color":{"$in":["Red","Blue","Green"]},"brand":{"$regularExpression":{"pattern":"^Ford","options":"i"}},"year":{"$gt":2015}},"sort":{"price":-1},"$db":"keyhole"},"planSummary":"IXSCAN { color: 1, year: 1 }","keysExamined":120,"docsExamined":120,"nreturned":10,"reslen":2048,"durationMillis":210}}`
+	li := NewLogInfo()
+	stat, err := li.ParseLog(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat2, err := li.ParseLogv2(v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{brand:/^.../i, color:{$in:[...]}, dealer:1, sold:1, year:{$gt:1}}, sort: {price:-1}`
+	if stat.filter != expected || stat2.filter != expected {
+		t.Fatal(stat.filter, stat2.filter)
+	}
+	if getShapeID(stat.op, stat.ns, stat.filter) != getShapeID(stat2.op, stat2.ns, stat2.filter) {
+		t.Fatal("shape ids differ", stat.op, stat2.op)
+	}
+
+	text = `2020-05-11T04:00:01.123+0000 I WRITE    [conn12] update keyhole.cars command: { q: { $or: [ { color: "Red" }, { name: { $regex: "^F", $options: "" } } ] }, u: { $set: { sold: true } }, multi: true, upsert: false } planSummary: COLLSCAN keysExamined:0 docsExamined:1000 nMatched:10 nModified:10 numYields:7 locks:{} 150ms`
+	v2 = `{"t":{"$date":"2020-09-11T04:00:01.123+00:00"},"s":"I","c":"WRITE","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"update","ns":"keyhole.cars","command":{"q":{"$or":[{"color":"Blue"},{"name":{"$regularExpression":{"pattern":"^T","options":""}}}]},"u":{"$set":{"sold":true}},"multi":true,"upsert":false},"planSummary":"COLLSCAN","keysExamined":0,"docsExamined":1000,"nMatched":10,"nModified":10,"numYields":7,"durationMillis":150}}`
+	if stat, err = li.ParseLog(text); err != nil {
+		t.Fatal(err)
+	}
+	if stat2, err = li.ParseLogv2(v2); err != nil {
+		t.Fatal(err)
+	}
+	expected = `{$or:[{color:1}, {name:/^.../}]}`
+	if stat.filter != expected || stat2.filter != expected {
+		t.Fatal(stat.filter, stat2.filter)
+	}
+}
+
+func TestParseLogDoc(t *testing.T) {
+	doc, ok := parseLogDoc(`{ b: { $in: [ 1, 2 ] }, a: "x", c: { d: Timestamp(1591, 1), e: BinData(0, ABCD) `).(logDoc)
+	if !ok || len(doc) != 3 || doc[0].key != "b" || doc[2].key != "c" {
+		t.Fatal(doc)
+	}
+	if shape := getFilterShape(doc); shape != `{a:1, b:{$in:[...]}, c:{d:1, e:1}}` {
+		t.Fatal(shape)
+	}
+	if shape := getSpecShape(parseLogDoc(`{ _id: "$color", total: { $sum: 1.0 } }`)); shape != `{_id:"$color", total:{$sum:1}}` {
+		t.Fatal(shape)
+	}
+}
+
+func TestPipelineShape(t *testing.T) {
+	text := `2020-05-11T04:00:02.123+0000 I COMMAND  [conn12] command keyhole.cars appName: "MongoDB Shell" command: aggregate { aggregate: "cars", pipeline: [ { $lookup: { from: "brands", localField: "brand", foreignField: "_id", as: "b" } }, { $unwind: "$b" }, { $match: { b.country: "DE", year: { $gte: 2018.0 } } }, { $group: { _id: "$b.name", total: { $sum: 1.0 } } }, { $sort: { total: -1.0 } }, { $limit: 10.0 } ], cursor: {}, $db: "keyhole" } planSummary: COLLSCAN keysExamined:0 docsExamined:5000 numYields:39 nreturned:5 reslen:200 protocol:op_msg 4693ms`
+	v2 := `{"t":{"$date":"2020-09-11T04:00:02.123+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn12","msg":"Slow query","attr":{"type":"command","ns":"keyhole.cars","command":{"aggregate":"cars","pipeline":[{"$lookup":{"from":"brands","localField":"brand","foreignField":"_id","as":"brand"}},{"$unwind":"$b"},{"$match":{"year":{"$gte":2020},"b.country":"US"}},{"$group":{"_id":"$b.name","total":{"$sum":1}}},{"$sort":{"total":-1}},{"$limit":5}],"cursor":{},"$db":"keyhole"},"planSummary":"COLLSCAN","keysExamined":0,"docsExamined":5000,"numYields":39,"nreturned":5,"reslen":200,"durationMillis":4693}}`
+	li := NewLogInfo()
+	stat, err := li.ParseLog(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat2, err := li.ParseLogv2(v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{$lookup:{from:"brands", localField:"brand", foreignField:"_id"}}, {$unwind:"$b"}, {$match:{b.country:1, year:{$gte:1}}}, {$group:{_id:"$b.name", total:{$sum:1}}}, {$sort:{total:-1}}, {$limit:1}]`
+	if stat.filter != expected || stat2.filter != expected {
+		t.Fatal(stat.filter, stat2.filter)
+	}
+
+	pipeline := parseLogDoc(`[ { $unionWith: { coll: "archive", pipeline: [ { $match: { color: "Red" } } ] } }, { $facet: { a: [ { $count: "n" } ] } } ]`)
+	if shape := getPipelineShape(pipeline); shape != `[{$unionWith:{coll:"archive", pipeline:[{$match:{color:1}}]}}, {$facet:{a:[{$count:1}]}}]` {
+		t.Fatal(shape)
+	}
+}